@@ -36,18 +36,16 @@ func TestApplyAndDestroy(t *testing.T) {
 
 	// Create API client and CIDR assigner
 	ctx := context.Background()
-	client := helper.CreateGodoClient()
-	cidrAssigner := helper.NewCidrAssigner(ctx, client)
+	clients := helper.CreateGodoClientsT(t, nil)
+	client := clients.Compute
+	cidrAssigner := helper.NewCidrAssignerWithOptions(ctx, client, &helper.CidrAssignerOptions{LeaseStore: helper.CidrLeaseStoreFromEnv()})
 
 	// Allocate non-overlapping CIDR blocks
-	vpcCidr := cidrAssigner.GetVpcCidr()
-	clusterCidr := cidrAssigner.GetDoksClusterCidr()
-	serviceCidr := cidrAssigner.GetDoksServiceCidr()
-	logger.Logf(t, "Allocated VPC CIDR: %s, Cluster CIDR: %s, Service CIDR: %s", vpcCidr, clusterCidr, serviceCidr)
+	network := cidrAssigner.GetDoksNetworkProfileT(t)
+	logger.Logf(t, "Allocated VPC CIDR: %s, Cluster CIDR: %s, Service CIDR: %s", network.VpcCidr, network.ClusterCidr, network.ServiceCidr)
 
 	// Create test domain for demo app (fqdn) and log sink (log_sink_fqdn)
-	testDomainFqdn := helper.CreateTestDomain(client, constant.TestRootSubdomain, testNamePrefix)
-	defer helper.DeleteTestDomain(client, constant.TestRootSubdomain, testNamePrefix)
+	testDomainFqdn := helper.CreateDelegatedTestDomainT(t, client.Domains, clients.DNS.Domains, constant.TestRootSubdomain, testNamePrefix)
 	logger.Logf(t, "Created test domain: %s", testDomainFqdn)
 
 	// Build FQDNs for the demo app and log sink
@@ -71,9 +69,9 @@ func TestApplyAndDestroy(t *testing.T) {
 		MixedVars: []terraform.Var{
 			terraform.VarFile("test.tfvars"),
 			terraform.VarInline("name_prefix", testNamePrefix),
-			terraform.VarInline("vpc_cidr", vpcCidr),
-			terraform.VarInline("doks_cluster_subnet", clusterCidr),
-			terraform.VarInline("doks_service_subnet", serviceCidr),
+			terraform.VarInline("vpc_cidr", network.VpcCidr),
+			terraform.VarInline("doks_cluster_subnet", network.ClusterCidr),
+			terraform.VarInline("doks_service_subnet", network.ServiceCidr),
 		},
 		NoColor: true,
 	})
@@ -31,10 +31,12 @@ func TestApplyAndDestroy(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	client := helper.CreateGodoClient()
-	testDomainFqdn := helper.CreateTestDomain(client, constant.TestRootSubdomain, testNamePrefix)
-	_, sshKey := helper.CreateSshKey(client, testNamePrefix)
-	cidrAssigner := helper.NewCidrAssigner(ctx, client)
+	clients := helper.CreateGodoClientsT(t, nil)
+	client := clients.Compute
+	testDomainFqdn := helper.CreateDelegatedTestDomainT(t, client.Domains, clients.DNS.Domains, constant.TestRootSubdomain, testNamePrefix)
+	_, sshKey := helper.CreateSshKeyT(t, client.Keys, testNamePrefix)
+	cidrAssigner := helper.NewCidrAssignerWithOptions(ctx, client, &helper.CidrAssignerOptions{LeaseStore: helper.CidrLeaseStoreFromEnv()})
+	vpcs := cidrAssigner.GetMultiRegionVpcProfileT(t, "nyc3", "sfo3", "ams3")
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		TerraformDir: testDir,
 		MixedVars: []terraform.Var{
@@ -42,28 +44,11 @@ func TestApplyAndDestroy(t *testing.T) {
 			terraform.VarInline("name_prefix", testNamePrefix),
 			terraform.VarInline("domain", testDomainFqdn),
 			terraform.VarInline("ssh_key", sshKey.Name),
-			terraform.VarInline("vpcs", []interface{}{
-				map[string]interface{}{
-					"region":   "nyc3",
-					"ip_range": cidrAssigner.GetVpcCidr(),
-				},
-				map[string]interface{}{
-					"region":   "sfo3",
-					"ip_range": cidrAssigner.GetVpcCidr(),
-				},
-				map[string]interface{}{
-					"region":   "ams3",
-					"ip_range": cidrAssigner.GetVpcCidr(),
-				},
-			}),
+			terraform.VarInline("vpcs", vpcs.TerraformValue()),
 		},
 		NoColor: true,
 	})
-	defer func() {
-		helper.TerraformDestroyVpcWithMembers(t, terraformOptions)
-		helper.DeleteTestDomain(client, constant.TestRootSubdomain, testNamePrefix)
-		helper.DeleteSshKey(client, sshKey.ID)
-	}()
+	defer helper.TerraformDestroyVpcWithMembers(t, terraformOptions)
 
 	terraform.InitAndApply(t, terraformOptions)
 
@@ -3,6 +3,9 @@ locals {
     "nat-gateway",
     var.name_prefix
   ]
+
+  # cloud-config keys installing the pinned SSH host key, if one is given
+  ssh_host_key_config = var.ssh_host_key == null ? "" : templatefile("${path.module}/ssh-host-key.yaml", var.ssh_host_key)
 }
 
 # VPC
@@ -110,6 +113,8 @@ resource "digitalocean_droplet" "bastion" {
   vpc_uuid = digitalocean_vpc.main.id
   ssh_keys = length(var.ssh_key_ids) > 0 ? var.ssh_key_ids : []
   tags     = concat(local.tags, ["bastion"])
+
+  user_data = var.ssh_host_key == null ? null : "#cloud-config\n${local.ssh_host_key_config}"
 }
 
 # Droplet with cloud-init to route traffic through NAT Gateway
@@ -124,6 +129,7 @@ resource "digitalocean_droplet" "private" {
 
   user_data = templatefile("${path.module}/cloud-init.yaml", {
     nat_gateway_gateway_ip = one(digitalocean_vpc_nat_gateway.main.vpcs).gateway_ip
+    ssh_host_key_config    = local.ssh_host_key_config
   })
 
 
@@ -34,3 +34,13 @@ variable "ssh_key_ids" {
   type        = list(string)
   default     = []
 }
+
+variable "ssh_host_key" {
+  description = "Optional ed25519 SSH host key for the bastion and NAT-routed droplet, so SSH clients can pin it instead of trusting whichever key the droplets generate. private_key is in OpenSSH format and public_key in authorized_keys format"
+  type = object({
+    private_key = string
+    public_key  = string
+  })
+  default   = null
+  sensitive = true
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -31,20 +30,20 @@ func TestApplyAndDestroy(t *testing.T) {
 
 	// Create API client and CIDR assigner
 	ctx := context.Background()
-	client := helper.CreateGodoClient()
-	cidrAssigner := helper.NewCidrAssigner(ctx, client)
+	client := helper.CreateGodoClientT(t)
+	cidrAssigner := helper.NewCidrAssignerWithOptions(ctx, client, &helper.CidrAssignerOptions{LeaseStore: helper.CidrLeaseStoreFromEnv()})
 
 	// Allocate non-overlapping CIDR blocks
-	vpcCidr := cidrAssigner.GetVpcCidr()
-	clusterCidr := cidrAssigner.GetDoksClusterCidr()
-	serviceCidr := cidrAssigner.GetDoksServiceCidr()
-	logger.Logf(t, "Allocated VPC CIDR: %s, Cluster CIDR: %s, Service CIDR: %s", vpcCidr, clusterCidr, serviceCidr)
+	network := cidrAssigner.GetDoksNetworkProfileT(t)
+	logger.Logf(t, "Allocated VPC CIDR: %s, Cluster CIDR: %s, Service CIDR: %s", network.VpcCidr, network.ClusterCidr, network.ServiceCidr)
 
 	// Generate SSH key for Droplet access
-	sshKeyPair, sshKey := helper.CreateSshKey(client, testNamePrefix)
-	defer helper.DeleteSshKey(client, sshKey.ID)
+	sshKeyPair, sshKey := helper.CreateSshKeyT(t, client.Keys, testNamePrefix)
 	logger.Logf(t, "Created SSH key: %s (ID: %d)", sshKey.Name, sshKey.ID)
 
+	// Pin the Droplets' SSH host key so the bastion and Droplet are verified, not trusted on first use
+	sshHostKey := helper.GenerateSshHostKeyT(t)
+
 	// Copy entire terraform directory to preserve relative path structure for remote_state
 	testDir := test_structure.CopyTerraformFolderToTemp(t, "../..", "./terraform")
 	logger.Logf(t, "Copied terraform directory to: %s", testDir)
@@ -61,10 +60,11 @@ func TestApplyAndDestroy(t *testing.T) {
 		MixedVars: []terraform.Var{
 			terraform.VarFile("test.tfvars"),
 			terraform.VarInline("name_prefix", testNamePrefix),
-			terraform.VarInline("vpc_cidr", vpcCidr),
-			terraform.VarInline("doks_cluster_subnet", clusterCidr),
-			terraform.VarInline("doks_service_subnet", serviceCidr),
+			terraform.VarInline("vpc_cidr", network.VpcCidr),
+			terraform.VarInline("doks_cluster_subnet", network.ClusterCidr),
+			terraform.VarInline("doks_service_subnet", network.ServiceCidr),
 			terraform.VarInline("ssh_key_ids", []string{fmt.Sprintf("%d", sshKey.ID)}),
+			terraform.VarInline("ssh_host_key", sshHostKey.TerraformVar()),
 		},
 		NoColor: true,
 	})
@@ -118,7 +118,7 @@ func TestApplyAndDestroy(t *testing.T) {
 
 	// Verify egress routing from Droplet (via bastion)
 	logger.Log(t, "Verifying egress routing from Droplet (via bastion)...")
-	verifyDropletEgress(t, bastionPublicIP, dropletPrivateIP, natPublicIP, sshKeyPair)
+	verifyDropletEgress(t, bastionPublicIP, dropletPrivateIP, natPublicIP, sshKeyPair, sshHostKey)
 
 	logger.Log(t, "All validations passed!")
 }
@@ -190,64 +190,33 @@ func verifyPodEgress(t *testing.T, kubectlOptions *k8s.KubectlOptions, expectedI
 }
 
 // verifyDropletEgress verifies that the Droplet's egress traffic uses the NAT Gateway public IP
-// This function connects to the droplet via the bastion host using SSH ProxyCommand
-func verifyDropletEgress(t *testing.T, bastionIP string, dropletPrivateIP string, expectedIP string, keyPair *keygen.KeyPair) {
+// This function connects to the droplet with the bastion host as a jump host, verifying both have hostKey
+func verifyDropletEgress(t *testing.T, bastionIP string, dropletPrivateIP string, expectedIP string, keyPair *keygen.KeyPair, hostKey *helper.SshHostKey) {
 	description := "Verifying Droplet egress IP via SSH (through bastion)"
 	maxRetries := 15
 	timeBetweenRetries := 10 * time.Second
 
-	// Write SSH private key to temporary file for SSH command
-	tmpKeyFile, err := os.CreateTemp("", "nat-gw-test-key-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp key file: %v", err)
-	}
-	defer os.Remove(tmpKeyFile.Name())
-
-	// Write private key and set proper permissions
-	if _, err := tmpKeyFile.Write(keyPair.RawPrivateKey()); err != nil {
-		t.Fatalf("Failed to write private key: %v", err)
-	}
-	if err := tmpKeyFile.Close(); err != nil {
-		t.Fatalf("Failed to close key file: %v", err)
-	}
-	if err := os.Chmod(tmpKeyFile.Name(), 0600); err != nil {
-		t.Fatalf("Failed to set key file permissions: %v", err)
-	}
-
-	logger.Logf(t, "SSH key written to: %s", tmpKeyFile.Name())
-
 	// Wait for SSH to be available and verify egress IP
 	actualIP := retry.DoWithRetry(t, description, maxRetries, timeBetweenRetries, func() (string, error) {
-		// Build SSH command with ProxyCommand to access droplet via bastion
-		// ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null \
-		//     -o ProxyCommand="ssh -W %h:%p -o StrictHostKeyChecking=no -i <key> root@<bastion>" \
-		//     -i <key> root@<droplet-private-ip> "curl -s --max-time 10 ifconfig.me"
-		proxyCmd := fmt.Sprintf("ssh -W %%h:%%p -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -i %s root@%s",
-			tmpKeyFile.Name(), bastionIP)
-
-		cmd := exec.Command("ssh",
-			"-o", "StrictHostKeyChecking=no",
-			"-o", "UserKnownHostsFile=/dev/null",
-			"-o", fmt.Sprintf("ProxyCommand=%s", proxyCmd),
-			"-i", tmpKeyFile.Name(),
-			fmt.Sprintf("root@%s", dropletPrivateIP),
-			"curl -s --max-time 10 ifconfig.me")
-
-		output, err := cmd.CombinedOutput()
+		runner, err := helper.NewSshRunnerE(dropletPrivateIP, keyPair, &helper.SshRunnerOptions{
+			JumpHosts:       []string{bastionIP},
+			HostKeyCallback: hostKey.HostKeyCallback(),
+			CommandTimeout:  30 * time.Second,
+		})
 		if err != nil {
-			return "", fmt.Errorf("SSH command failed: %v, output: %s", err, string(output))
+			return "", err
 		}
+		defer runner.Close()
 
-		// SSH may include warning messages about known_hosts, so extract the last line
-		// which contains the actual curl output
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-		result := strings.TrimSpace(lines[len(lines)-1])
-
-		if result == "" {
+		result, err := runner.RunE(context.Background(), "curl -s --max-time 10 ifconfig.me")
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(result.Stdout) == "" {
 			return "", fmt.Errorf("empty response from ifconfig.me")
 		}
 
-		return result, nil
+		return result.Stdout, nil
 	})
 
 	// Verify the IP matches NAT Gateway public IP
@@ -1,16 +1,12 @@
 package integration
 
 import (
-	"context"
 	"fmt"
-	"github.com/digitalocean/godo"
 	"github.com/digitalocean/scale-with-simplicity/test/helper"
 	"github.com/gruntwork-io/terratest/modules/files"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
-	"github.com/stretchr/testify/assert"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -19,46 +15,6 @@ import (
 	"time"
 )
 
-// validateRoute returns true if the given cidr is present in the list of
-// remote routes for the specified Partner Attachment ID.
-func validateRoute(client *godo.Client, pncAttachmentId, cidr string) bool {
-	ctx := context.Background()
-	opt := &godo.ListOptions{}
-
-	for {
-		routes, resp, err := client.PartnerAttachment.ListRoutes(ctx, pncAttachmentId, opt)
-		if err != nil {
-			log.Printf("error listing routes for attachment %s: %v", pncAttachmentId, err)
-			return false
-		}
-
-		for _, r := range routes {
-			if r.Cidr == cidr {
-				return true
-			}
-		}
-
-		// no more pages
-		if resp.Links == nil || resp.Links.IsLastPage() {
-			break
-		}
-
-		page, err := resp.Links.CurrentPage()
-		if err != nil {
-			log.Printf("error getting current page for attachment %s: %v", pncAttachmentId, err)
-			return false
-		}
-		opt.Page = page + 1
-	}
-
-	return false
-}
-
-func TestValidateRoute(t *testing.T) {
-	client := helper.CreateGodoClient()
-	assert.Equal(t, true, validateRoute(client, "31c51cd7-6914-4e37-b952-3ef6c8888fc3", "192.168.1.0/24"))
-}
-
 func TestApplyAndDestroy(t *testing.T) {
 	t.Parallel()
 
@@ -80,7 +36,7 @@ func TestApplyAndDestroy(t *testing.T) {
 		t.Fatalf("Failed to copy tfvars file: %v", err)
 	}
 
-	client := helper.CreateGodoClient()
+	client := helper.CreateGodoClientT(t)
 	awsVpcCidr := "192.168.0.0/24"
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		TerraformDir: testDir,
@@ -99,7 +55,10 @@ func TestApplyAndDestroy(t *testing.T) {
 	pncAttachmentId := terraform.Output(t, terraformOptions, "partner_attachment_uuid_red")
 
 	for i := 0; i < maxRetries; i++ {
-		if validateRoute(client, pncAttachmentId, awsVpcCidr) {
+		found, err := helper.PartnerAttachmentHasRouteE(client.PartnerAttachment, pncAttachmentId, awsVpcCidr)
+		if err != nil {
+			t.Logf("Failed to check routes on attempt %d: %v", i+1, err)
+		} else if found {
 			t.Logf("Route %s found on attempt %d", awsVpcCidr, i+1)
 			return // test passed
 		}
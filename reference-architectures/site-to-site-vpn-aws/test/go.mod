@@ -7,6 +7,11 @@ require (
 	github.com/gruntwork-io/terratest v0.50.0
 )
 
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	github.com/pkg/sftp v1.13.10 // indirect
+)
+
 replace github.com/digitalocean/scale-with-simplicity/test => ../../../test
 
 require (
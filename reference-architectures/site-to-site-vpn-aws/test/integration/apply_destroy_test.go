@@ -87,9 +87,26 @@ func TestApplyAndDestroy(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	client := helper.CreateGodoClient()
-	_, sshKey := helper.CreateSshKey(client, testNamePrefix)
-	cidrAssigner := helper.NewCidrAssigner(ctx, client)
+	client := helper.CreateGodoClientT(t)
+	_, sshKey := helper.CreateSshKeyT(t, client.Keys, testNamePrefix)
+
+	// Create an EC2 client, used to avoid existing AWS VPCs and to verify that the VPN comes up
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		t.Fatalf("unable to load AWS config: %v", err)
+	}
+	ec2Client := ec2.NewFromConfig(cfg)
+
+	// The DO side must not overlap anything the VPN routes to, including the AWS VPC from test.tfvars
+	cidrSources := append(helper.DefaultCidrSources(client),
+		helper.NewAwsVpcCidrSource(ec2Client),
+		helper.NewStaticCidrSource("test.tfvars", terraform.GetVariableAsStringFromVarFile(t, "../test.tfvars", "aws_vpc_cidr")),
+	)
+	cidrAssigner := helper.NewCidrAssignerWithOptions(ctx, client, &helper.CidrAssignerOptions{
+		Sources:    cidrSources,
+		LeaseStore: helper.CidrLeaseStoreFromEnv(),
+	})
+	network := cidrAssigner.GetDoksNetworkProfileT(t)
 
 	// Configure Terraform options
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
@@ -97,24 +114,15 @@ func TestApplyAndDestroy(t *testing.T) {
 		MixedVars: []terraform.Var{
 			terraform.VarFile("test.tfvars"),
 			terraform.VarInline("name_prefix", testNamePrefix),
-			terraform.VarInline("do_vpc_cidr", cidrAssigner.GetVpcCidr()),
-			terraform.VarInline("doks_cluster_subnet", cidrAssigner.GetDoksClusterCidr()),
-			terraform.VarInline("doks_service_subnet", cidrAssigner.GetDoksServiceCidr()),
+			terraform.VarInline("do_vpc_cidr", network.VpcCidr),
+			terraform.VarInline("doks_cluster_subnet", network.ClusterCidr),
+			terraform.VarInline("doks_service_subnet", network.ServiceCidr),
 			terraform.VarInline("droplet_ssh_keys", []int{sshKey.ID}),
 		},
 		NoColor: true,
 	})
-	defer func() {
-		helper.TerraformDestroyVpcWithMembers(t, terraformOptions)
-		helper.DeleteSshKey(client, sshKey.ID)
-	}()
+	defer helper.TerraformDestroyVpcWithMembers(t, terraformOptions)
 	terraform.InitAndApply(t, terraformOptions)
 
-	// Create an EC2 client and verify that the VPN comes up
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		t.Fatalf("unable to load AWS config: %v", err)
-	}
-	ec2Client := ec2.NewFromConfig(cfg)
 	verifyVpnUp(t, context.Background(), ec2Client, testNamePrefix)
 }
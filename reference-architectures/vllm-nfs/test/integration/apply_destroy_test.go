@@ -32,14 +32,12 @@ func TestApplyAndDestroy(t *testing.T) {
 
 	// Create API client and CIDR assigner
 	ctx := context.Background()
-	client := helper.CreateGodoClient()
-	cidrAssigner := helper.NewCidrAssigner(ctx, client)
+	client := helper.CreateGodoClientT(t)
+	cidrAssigner := helper.NewCidrAssignerWithOptions(ctx, client, &helper.CidrAssignerOptions{LeaseStore: helper.CidrLeaseStoreFromEnv()})
 
 	// Allocate non-overlapping CIDR blocks
-	vpcCidr := cidrAssigner.GetVpcCidr()
-	clusterCidr := cidrAssigner.GetDoksClusterCidr()
-	serviceCidr := cidrAssigner.GetDoksServiceCidr()
-	logger.Logf(t, "Allocated VPC CIDR: %s, Cluster CIDR: %s, Service CIDR: %s", vpcCidr, clusterCidr, serviceCidr)
+	network := cidrAssigner.GetDoksNetworkProfileT(t)
+	logger.Logf(t, "Allocated VPC CIDR: %s, Cluster CIDR: %s, Service CIDR: %s", network.VpcCidr, network.ClusterCidr, network.ServiceCidr)
 
 	// Copy entire terraform directory to preserve relative path structure for remote_state
 	testDir := test_structure.CopyTerraformFolderToTemp(t, "../..", "./terraform")
@@ -57,9 +55,9 @@ func TestApplyAndDestroy(t *testing.T) {
 		MixedVars: []terraform.Var{
 			terraform.VarFile("test.tfvars"),
 			terraform.VarInline("name_prefix", testNamePrefix),
-			terraform.VarInline("vpc_cidr", vpcCidr),
-			terraform.VarInline("doks_cluster_subnet", clusterCidr),
-			terraform.VarInline("doks_service_subnet", serviceCidr),
+			terraform.VarInline("vpc_cidr", network.VpcCidr),
+			terraform.VarInline("doks_cluster_subnet", network.ClusterCidr),
+			terraform.VarInline("doks_service_subnet", network.ServiceCidr),
 			terraform.VarInline("gpu_node_count", 1), // Minimum for test
 		},
 		NoColor: true,
@@ -0,0 +1,120 @@
+package cassette
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in a cassette.
+const Redacted = "REDACTED"
+
+const (
+	// pseudonymPrefix starts every pseudonymous UUID, so sanitizing a pseudonym again leaves it unchanged.
+	pseudonymPrefix = "00000000-0000-4"
+
+	// numericPseudonymPrefix starts every pseudonymous numeric ID, which has six more digits. Real Droplet,
+	// SSH key and domain record IDs are shorter, so sanitizing a pseudonym again leaves it unchanged.
+	numericPseudonymPrefix = "9000"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+
+	// DigitalOcean personal access, OAuth and refresh tokens
+	doTokenPattern = regexp.MustCompile(`\bdo[opr]_v1_[0-9a-f]{64}\b`)
+
+	// Credentials in JSON bodies, e.g. a kubeconfig token or a database password
+	jsonSecretPattern = regexp.MustCompile(`("(?:token|access_token|refresh_token|password|client-key-data|client-certificate-data|certificate-authority-data)"\s*:\s*)"[^"]*"`)
+
+	// Credentials in YAML bodies, i.e. kubeconfigs
+	yamlSecretPattern = regexp.MustCompile(`(?m)^(\s*(?:token|client-key-data|client-certificate-data|certificate-authority-data):[ \t]*)\S.*$`)
+
+	// Numeric IDs in JSON bodies, e.g. a Droplet's "id", a node's "droplet_id" (a string), the "droplet_ids"
+	// of a load balancer or the "ssh_keys" of a Droplet create request
+	jsonIDPattern = regexp.MustCompile(`("(?:id|[a-z_]+_id|[a-z_]+_ids|ssh_keys)"\s*:\s*)(\[[^\]]*\]|"\d+"|\d+)`)
+
+	// A numeric ID on its own, optionally quoted
+	numericIDPattern = regexp.MustCompile(`^(\s*"?)(\d+)("?\s*)$`)
+)
+
+// sanitizer scrubs secrets from recorded requests and responses.
+type sanitizer struct {
+	redact []string
+}
+
+func newSanitizer(redact []string) *sanitizer {
+	s := &sanitizer{}
+	for _, value := range redact {
+		if value != "" {
+			s.redact = append(s.redact, value)
+		}
+	}
+	return s
+}
+
+// url returns the sanitized path and query of u. Numeric path segments, e.g. /v2/droplets/12345, are IDs.
+func (s *sanitizer) url(u *url.URL) string {
+	sanitized := *u
+	sanitized.Path = scrubNumericIDs(u.Path, "/")
+	sanitized.RawPath = ""
+	return s.scrub(pathAndQuery(&sanitized))
+}
+
+// body returns data as a sanitized string.
+func (s *sanitizer) body(data []byte) string {
+	body := s.scrub(string(data))
+	body = jsonSecretPattern.ReplaceAllString(body, `${1}"`+Redacted+`"`)
+	body = jsonIDPattern.ReplaceAllStringFunc(body, func(match string) string {
+		groups := jsonIDPattern.FindStringSubmatch(match)
+		return groups[1] + scrubNumericIDs(groups[2], ",")
+	})
+	return yamlSecretPattern.ReplaceAllString(body, "${1}"+Redacted)
+}
+
+// scrub redacts tokens and the configured strings, and replaces UUIDs with pseudonyms.
+func (s *sanitizer) scrub(text string) string {
+	for _, value := range s.redact {
+		text = strings.ReplaceAll(text, value, Redacted)
+	}
+	text = doTokenPattern.ReplaceAllString(text, Redacted)
+	return uuidPattern.ReplaceAllStringFunc(text, pseudonym)
+}
+
+// pseudonym returns a UUID derived from a hash of id. The same ID always gets the same pseudonym, so IDs
+// returned by one request still match the URLs of later ones, and a test that uses a literal ID still finds
+// its interactions on replay.
+func pseudonym(id string) string {
+	id = strings.ToLower(id)
+	if strings.HasPrefix(id, pseudonymPrefix) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	h := hex.EncodeToString(sum[:])
+	return pseudonymPrefix + h[:3] + "-8" + h[3:6] + "-" + h[6:18]
+}
+
+// numericPseudonym is pseudonym for numeric IDs such as Droplet, SSH key and domain record IDs.
+func numericPseudonym(id string) string {
+	if len(id) == len(numericPseudonymPrefix)+6 && strings.HasPrefix(id, numericPseudonymPrefix) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return fmt.Sprintf("%s%06d", numericPseudonymPrefix, binary.BigEndian.Uint64(sum[:8])%1_000_000)
+}
+
+// scrubNumericIDs replaces the elements of the sep-separated list that are numeric IDs with their pseudonyms,
+// leaving other elements, such as SSH key fingerprints next to key IDs, as they are.
+func scrubNumericIDs(list, sep string) string {
+	elements := strings.Split(list, sep)
+	for i, element := range elements {
+		if groups := numericIDPattern.FindStringSubmatch(strings.Trim(element, "[]")); groups != nil {
+			elements[i] = strings.Replace(element, groups[0], groups[1]+numericPseudonym(groups[2])+groups[3], 1)
+		}
+	}
+	return strings.Join(elements, sep)
+}
@@ -0,0 +1,325 @@
+// Command cidrctl inspects the address space in use in a DigitalOcean account and reserves blocks for manual use,
+// using the same rules as helper.CidrAssigner. It reads $DIGITALOCEAN_ACCESS_TOKEN.
+//
+//	cidrctl list                           # every range in use, with its source and owner
+//	cidrctl free -prefix 24 -limit 10      # free /24s in 10.0.0.0/8
+//	cidrctl map                            # fragmentation map of 10/8, 172.16/12 and 192.168/16
+//	cidrctl reserve -prefix 24 -lease-file /tmp/sws-cidr-leases.json
+//	cidrctl release -owner me -lease-file /tmp/sws-cidr-leases.json 10.1.0.0/24
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/digitalocean/scale-with-simplicity/test/helper"
+)
+
+// mapPools are the pools printed by the map command.
+var mapPools = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+const usage = `Usage: cidrctl <command> [flags]
+
+Commands:
+  list      List every range in use, with its source and owner
+  free      Show the free blocks of a given size in a pool
+  map       Print a fragmentation map of 10.0.0.0/8, 172.16.0.0/12 and 192.168.0.0/16
+  reserve   Lease a free block for manual use
+  release   Release a block leased with reserve
+
+Run "cidrctl <command> -h" for the flags of each command.
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, nil); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "cidrctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run executes the command in args. sources replaces the account's VPCs and DOKS clusters if it is not nil.
+func run(ctx context.Context, args []string, stdout io.Writer, sources []helper.CidrSource) error {
+	if len(args) == 0 {
+		fmt.Fprint(stdout, usage)
+		return flag.ErrHelp
+	}
+
+	cmd := &command{ctx: ctx, stdout: stdout, sources: sources}
+	flags := flag.NewFlagSet("cidrctl "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	flags.StringVar(&cmd.godoContext, "context", "", "doctl auth context or named credentials to list the account with (default: the current one)")
+	flags.StringVar(&cmd.leaseFile, "lease-file", "", "File lease store to read (and for reserve and release, update) (default: $CIDR_LEASE_FILE)")
+	flags.StringVar(&cmd.leaseURL, "lease-url", "", "HTTP lease store URL, used instead of -lease-file (default: $CIDR_LEASE_URL)")
+	flags.StringVar(&cmd.leaseToken, "lease-token", "", "Bearer token sent to -lease-url (default: $CIDR_LEASE_TOKEN)")
+	flags.Var(&cmd.excluded, "exclude", "Extra range to treat as in use; may be repeated")
+
+	var action func() error
+	switch args[0] {
+	case "list":
+		action = cmd.list
+	case "free":
+		flags.StringVar(&cmd.pool, "pool", helper.DefaultCidrPool, "Pool to search")
+		flags.IntVar(&cmd.prefixLength, "prefix", 24, "Prefix length of the blocks")
+		flags.IntVar(&cmd.limit, "limit", 20, "Maximum number of blocks to show; 0 shows all")
+		action = cmd.free
+	case "map":
+		flags.IntVar(&cmd.width, "width", 64, "Number of cells per pool; must be a power of two")
+		action = cmd.fragmentationMap
+	case "reserve":
+		flags.StringVar(&cmd.pool, "pool", helper.DefaultCidrPool, "Pool to allocate from")
+		flags.IntVar(&cmd.prefixLength, "prefix", 24, "Prefix length of the block")
+		flags.StringVar(&cmd.owner, "owner", defaultOwner(), "Owner recorded on the lease")
+		flags.DurationVar(&cmd.ttl, "ttl", 24*time.Hour, "How long the lease is held")
+		action = cmd.reserve
+	case "release":
+		flags.StringVar(&cmd.owner, "owner", defaultOwner(), "Owner the block was reserved by")
+		action = cmd.release
+	default:
+		fmt.Fprint(stdout, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	cmd.args = flags.Args()
+	return action()
+}
+
+// command holds the parsed flags of a cidrctl command.
+type command struct {
+	ctx     context.Context
+	stdout  io.Writer
+	sources []helper.CidrSource
+	args    []string
+
+	godoContext  string
+	leaseFile    string
+	leaseURL     string
+	leaseToken   string
+	excluded     stringList
+	pool         string
+	prefixLength int
+	limit        int
+	width        int
+	owner        string
+	ttl          time.Duration
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// leaseStore returns the lease store given by the flags, or by the environment like the test helpers,
+// or nil if there is none.
+func (c *command) leaseStore() helper.CidrLeaseStore {
+	switch {
+	case c.leaseURL != "":
+		token := c.leaseToken
+		if token == "" {
+			token = os.Getenv("CIDR_LEASE_TOKEN")
+		}
+		header := http.Header{}
+		if token != "" {
+			header.Set("Authorization", "Bearer "+token)
+		}
+		return helper.NewRemoteCidrLeaseStore(helper.NewHTTPCidrLeaseBackend(c.leaseURL, nil, header))
+	case c.leaseFile != "":
+		return helper.NewFileCidrLeaseStore(c.leaseFile)
+	}
+	return helper.CidrLeaseStoreFromEnv()
+}
+
+// assigner creates a CidrAssigner over the account (or c.sources) and the configured lease store.
+func (c *command) assigner() (*helper.CidrAssigner, error) {
+	sources := c.sources
+	if sources == nil {
+		client, err := helper.CreateGodoClientWithOptionsE(&helper.GodoClientOptions{Context: c.godoContext})
+		if err != nil {
+			return nil, err
+		}
+		sources = helper.DefaultCidrSources(client)
+	}
+	return helper.NewCidrAssignerWithOptions(c.ctx, nil, &helper.CidrAssignerOptions{
+		Sources:       sources,
+		ExcludedCidrs: c.excluded,
+		LeaseStore:    c.leaseStore(),
+		LeaseOwner:    c.owner,
+		LeaseTTL:      c.ttl,
+	}), nil
+}
+
+// list prints every existing network, exclusion and lease, sorted by address.
+func (c *command) list() error {
+	assigner, err := c.assigner()
+	if err != nil {
+		return err
+	}
+	ranges, err := assigner.Inventory()
+	if err != nil {
+		return err
+	}
+	for _, cidr := range helper.DigitalOceanReservedCidrs {
+		ranges = append(ranges, helper.CidrRange{Cidr: cidr, Owner: "DigitalOcean", Source: "reserved"})
+	}
+	for _, cidr := range c.excluded {
+		ranges = append(ranges, helper.CidrRange{Cidr: cidr, Source: "excluded"})
+	}
+	if store := c.leaseStore(); store != nil {
+		leases, err := store.List(c.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list CIDR leases: %w", err)
+		}
+		for _, lease := range leases {
+			ranges = append(ranges, helper.CidrRange{Cidr: lease.Cidr, Owner: lease.Owner, Source: "lease"})
+		}
+	}
+	sortRanges(ranges)
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CIDR\tSOURCE\tOWNER")
+	for _, r := range ranges {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Cidr, r.Source, r.Owner)
+	}
+	return w.Flush()
+}
+
+// sortRanges orders ranges by address, then by prefix length, putting unparseable ranges last.
+func sortRanges(ranges []helper.CidrRange) {
+	sort.SliceStable(ranges, func(i, j int) bool {
+		a, errA := netip.ParsePrefix(ranges[i].Cidr)
+		b, errB := netip.ParsePrefix(ranges[j].Cidr)
+		if errA != nil || errB != nil {
+			return errB != nil && errA == nil
+		}
+		if cmp := a.Addr().Compare(b.Addr()); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+}
+
+// free prints the free blocks of the requested size.
+func (c *command) free() error {
+	assigner, err := c.assigner()
+	if err != nil {
+		return err
+	}
+	blocks, err := assigner.FreeBlocks(c.pool, c.prefixLength, c.limit)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no free /%d blocks in %s", c.prefixLength, c.pool)
+	}
+	for _, block := range blocks {
+		fmt.Fprintln(c.stdout, block)
+	}
+	return nil
+}
+
+// fragmentationMap prints a row of cells for each of mapPools, showing how much of each slice of the pool is in use.
+func (c *command) fragmentationMap() error {
+	assigner, err := c.assigner()
+	if err != nil {
+		return err
+	}
+	for _, pool := range mapPools {
+		usage, err := assigner.PoolUsage(pool, c.width)
+		if err != nil {
+			return err
+		}
+		total := new(big.Int).Add(usage.UsedAddresses, usage.FreeAddresses)
+		percent, _ := new(big.Float).Quo(new(big.Float).SetInt(usage.UsedAddresses), new(big.Float).SetInt(total)).Float64()
+		largest := "none"
+		if usage.LargestFreePrefix > 0 {
+			largest = fmt.Sprintf("/%d", usage.LargestFreePrefix)
+		}
+		fmt.Fprintf(c.stdout, "%-15s %5.1f%% used, %s free addresses in %d fragments, largest free block %s\n",
+			usage.Pool, percent*100, usage.FreeAddresses, usage.FreeFragments, largest)
+		fmt.Fprintf(c.stdout, "[%s]\n", cells(usage.Cells))
+	}
+	fmt.Fprintln(c.stdout, "Each cell is an equal slice of the pool: . free, - under half used, + half or more used, # full")
+	return nil
+}
+
+// cells renders each fraction in use as one character.
+func cells(fractions []float64) string {
+	var b strings.Builder
+	for _, f := range fractions {
+		switch {
+		case f == 0:
+			b.WriteByte('.')
+		case f < 0.5:
+			b.WriteByte('-')
+		case f < 1:
+			b.WriteByte('+')
+		default:
+			b.WriteByte('#')
+		}
+	}
+	return b.String()
+}
+
+// reserve leases a free block and prints it.
+func (c *command) reserve() error {
+	if c.leaseStore() == nil {
+		return errors.New("reserve needs -lease-file or -lease-url (or $CIDR_LEASE_URL or $CIDR_LEASE_FILE), otherwise the block is forgotten when cidrctl exits")
+	}
+	assigner, err := c.assigner()
+	if err != nil {
+		return err
+	}
+	cidr, err := assigner.GetCidrBlockFromPool(c.pool, c.prefixLength)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, cidr)
+	return nil
+}
+
+// release releases the blocks given as arguments.
+func (c *command) release() error {
+	store := c.leaseStore()
+	if store == nil {
+		return errors.New("release needs -lease-file or -lease-url")
+	}
+	if len(c.args) == 0 {
+		return errors.New("release needs at least one CIDR")
+	}
+	for _, cidr := range c.args {
+		if err := store.Release(c.ctx, cidr, c.owner); err != nil {
+			return fmt.Errorf("failed to release %s: %w", cidr, err)
+		}
+	}
+	return nil
+}
+
+// defaultOwner identifies the person running cidrctl on leases.
+func defaultOwner() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cidrctl-" + u.Username
+	}
+	return helper.DefaultCidrLeaseOwner()
+}
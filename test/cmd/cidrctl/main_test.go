@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/digitalocean/scale-with-simplicity/test/helper"
+)
+
+func testSources() []helper.CidrSource {
+	return []helper.CidrSource{
+		helper.NewStaticCidrSource("digitalocean-vpc", "10.0.0.0/24"),
+		helper.NewStaticCidrSource("doks-cluster", "10.0.32.0/19", "10.0.4.0/22"),
+	}
+}
+
+// isolateLeaseEnv clears the lease store variables, so tests never use a developer's or CI's ledger
+func isolateLeaseEnv(t *testing.T) {
+	for _, name := range []string{"CIDR_LEASE_URL", "CIDR_LEASE_TOKEN", "CIDR_LEASE_FILE"} {
+		t.Setenv(name, "")
+	}
+}
+
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := run(context.Background(), args, &out, testSources())
+	return out.String(), err
+}
+
+func TestList(t *testing.T) {
+	isolateLeaseEnv(t)
+	out, err := runCommand(t, "list", "-exclude", "10.0.1.0/24")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Regexp(t, `^CIDR\s+SOURCE\s+OWNER$`, lines[0])
+	assert.Regexp(t, `^10\.0\.0\.0/24\s+digitalocean-vpc\s+digitalocean-vpc$`, lines[1])
+	assert.Regexp(t, `^10\.0\.1\.0/24\s+excluded\s*$`, lines[2])
+	assert.Regexp(t, `^10\.0\.4\.0/22\s+doks-cluster\s+doks-cluster$`, lines[3])
+	assert.Contains(t, out, "10.244.0.0/16")
+}
+
+func TestFree(t *testing.T) {
+	isolateLeaseEnv(t)
+	out, err := runCommand(t, "free", "-prefix", "22", "-limit", "3")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.8.0/22\n10.0.12.0/22\n10.0.16.0/22\n", out)
+
+	_, err = runCommand(t, "free", "-pool", "10.0.0.0/24", "-prefix", "28")
+	assert.EqualError(t, err, "no free /28 blocks in 10.0.0.0/24")
+}
+
+func TestMap(t *testing.T) {
+	isolateLeaseEnv(t)
+	out, err := runCommand(t, "map", "-width", "8")
+	require.NoError(t, err)
+	assert.Contains(t, out, "172.16.0.0/12     6.2% used, 983040 free addresses in 2 fragments, largest free block /13\n[+.......]\n")
+	assert.Contains(t, out, "192.168.0.0/16    0.0% used, 65536 free addresses in 1 fragments, largest free block /16\n[........]\n")
+}
+
+func TestReserveAndRelease(t *testing.T) {
+	isolateLeaseEnv(t)
+	leases := filepath.Join(t.TempDir(), "leases.json")
+
+	_, err := runCommand(t, "reserve")
+	assert.ErrorContains(t, err, "reserve needs -lease-file or -lease-url")
+
+	out, err := runCommand(t, "reserve", "-lease-file", leases, "-owner", "me")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24\n", out)
+
+	// The reservation is seen by later commands sharing the lease file
+	out, err = runCommand(t, "reserve", "-lease-file", leases, "-owner", "me")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.2.0/24\n", out)
+
+	out, err = runCommand(t, "list", "-lease-file", leases)
+	require.NoError(t, err)
+	assert.Regexp(t, `10\.0\.1\.0/24\s+lease\s+me\n`, out)
+
+	_, err = runCommand(t, "release", "-lease-file", leases, "-owner", "me", "10.0.1.0/24", "10.0.2.0/24")
+	require.NoError(t, err)
+	out, err = runCommand(t, "free", "-lease-file", leases, "-limit", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24\n", out)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	isolateLeaseEnv(t)
+	out, err := runCommand(t, "frobnicate")
+	assert.EqualError(t, err, `unknown command "frobnicate"`)
+	assert.Contains(t, out, "Usage: cidrctl <command> [flags]")
+}
+
+func TestReserve_LeaseURLSendsToken(t *testing.T) {
+	isolateLeaseEnv(t)
+	ledger := helper.NewCidrLeaseServer()
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ledger.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	out, err := runCommand(t, "reserve", "-lease-url", server.URL+"/leases.json", "-lease-token", "flag-token", "-owner", "me")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24\n", out)
+
+	t.Setenv("CIDR_LEASE_TOKEN", "env-token")
+	_, err = runCommand(t, "reserve", "-lease-url", server.URL+"/leases.json", "-owner", "me")
+	require.NoError(t, err)
+
+	require.NotEmpty(t, authorizations)
+	assert.Equal(t, "Bearer flag-token", authorizations[0])
+	assert.Equal(t, "Bearer env-token", authorizations[len(authorizations)-1])
+	assert.NotContains(t, authorizations, "")
+}
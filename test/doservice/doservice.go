@@ -0,0 +1,71 @@
+// Package doservice declares the parts of the godo services the test helpers use. The helpers depend on these
+// interfaces rather than on *godo.Client, so tests only fake the methods a helper calls, and godo upgrades that
+// add methods to its services don't break them. Pass the matching field of a godo.Client, e.g.
+// helper.NewVpcCidrSource(client.VPCs) or helper.CreateSshKeyT(t, client.Keys, name).
+//
+// Package doservicefakes holds fakes of every interface, generated by a pinned counterfeiter version; run
+// go generate after changing an interface.
+package doservice
+
+import (
+	"context"
+
+	"github.com/digitalocean/godo"
+)
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6@v6.12.2 -generate
+
+//counterfeiter:generate -o doservicefakes/fake-vpc-lister.go . VpcLister
+//counterfeiter:generate -o doservicefakes/fake-kubernetes-cluster-lister.go . KubernetesClusterLister
+//counterfeiter:generate -o doservicefakes/fake-kubernetes-cluster-service.go . KubernetesClusterService
+//counterfeiter:generate -o doservicefakes/fake-partner-attachment-route-lister.go . PartnerAttachmentRouteLister
+//counterfeiter:generate -o doservicefakes/fake-key-service.go . KeyService
+//counterfeiter:generate -o doservicefakes/fake-domain-service.go . DomainService
+
+// VpcLister lists the VPCs in an account. It is satisfied by godo.Client.VPCs.
+type VpcLister interface {
+	List(ctx context.Context, opt *godo.ListOptions) ([]*godo.VPC, *godo.Response, error)
+}
+
+// KubernetesClusterLister lists the DOKS clusters in an account. It is satisfied by godo.Client.Kubernetes.
+type KubernetesClusterLister interface {
+	List(ctx context.Context, opt *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error)
+}
+
+// KubernetesClusterService lists DOKS clusters and fetches their kubeconfigs. It is satisfied by godo.Client.Kubernetes.
+type KubernetesClusterService interface {
+	KubernetesClusterLister
+	GetKubeConfig(ctx context.Context, clusterID string) (*godo.KubernetesClusterConfig, *godo.Response, error)
+}
+
+// PartnerAttachmentRouteLister lists Partner Network Connect attachments and their remote routes.
+// It is satisfied by godo.Client.PartnerAttachment.
+type PartnerAttachmentRouteLister interface {
+	List(ctx context.Context, opt *godo.ListOptions) ([]*godo.PartnerAttachment, *godo.Response, error)
+	ListRoutes(ctx context.Context, id string, opt *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error)
+}
+
+// KeyService adds and removes SSH keys. It is satisfied by godo.Client.Keys.
+type KeyService interface {
+	Create(ctx context.Context, createRequest *godo.KeyCreateRequest) (*godo.Key, *godo.Response, error)
+	GetByID(ctx context.Context, keyID int) (*godo.Key, *godo.Response, error)
+	DeleteByID(ctx context.Context, keyID int) (*godo.Response, error)
+}
+
+// DomainService creates and deletes domains and their records. It is satisfied by godo.Client.Domains.
+type DomainService interface {
+	Create(ctx context.Context, createRequest *godo.DomainCreateRequest) (*godo.Domain, *godo.Response, error)
+	Delete(ctx context.Context, name string) (*godo.Response, error)
+	CreateRecord(ctx context.Context, domain string, createRequest *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error)
+	RecordsByName(ctx context.Context, domain, name string, opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error)
+	DeleteRecord(ctx context.Context, domain string, id int) (*godo.Response, error)
+}
+
+// Fail to compile if godo's services stop satisfying the interfaces
+var (
+	_ VpcLister                    = godo.VPCsService(nil)
+	_ KubernetesClusterService     = godo.KubernetesService(nil)
+	_ PartnerAttachmentRouteLister = godo.PartnerAttachmentService(nil)
+	_ KeyService                   = godo.KeysService(nil)
+	_ DomainService                = godo.DomainsService(nil)
+)
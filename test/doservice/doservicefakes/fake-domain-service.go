@@ -0,0 +1,457 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package doservicefakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
+)
+
+type FakeDomainService struct {
+	CreateStub        func(context.Context, *godo.DomainCreateRequest) (*godo.Domain, *godo.Response, error)
+	createMutex       sync.RWMutex
+	createArgsForCall []struct {
+		arg1 context.Context
+		arg2 *godo.DomainCreateRequest
+	}
+	createReturns struct {
+		result1 *godo.Domain
+		result2 *godo.Response
+		result3 error
+	}
+	createReturnsOnCall map[int]struct {
+		result1 *godo.Domain
+		result2 *godo.Response
+		result3 error
+	}
+	CreateRecordStub        func(context.Context, string, *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error)
+	createRecordMutex       sync.RWMutex
+	createRecordArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 *godo.DomainRecordEditRequest
+	}
+	createRecordReturns struct {
+		result1 *godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}
+	createRecordReturnsOnCall map[int]struct {
+		result1 *godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}
+	DeleteStub        func(context.Context, string) (*godo.Response, error)
+	deleteMutex       sync.RWMutex
+	deleteArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+	}
+	deleteReturns struct {
+		result1 *godo.Response
+		result2 error
+	}
+	deleteReturnsOnCall map[int]struct {
+		result1 *godo.Response
+		result2 error
+	}
+	DeleteRecordStub        func(context.Context, string, int) (*godo.Response, error)
+	deleteRecordMutex       sync.RWMutex
+	deleteRecordArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 int
+	}
+	deleteRecordReturns struct {
+		result1 *godo.Response
+		result2 error
+	}
+	deleteRecordReturnsOnCall map[int]struct {
+		result1 *godo.Response
+		result2 error
+	}
+	RecordsByNameStub        func(context.Context, string, string, *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error)
+	recordsByNameMutex       sync.RWMutex
+	recordsByNameArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+		arg4 *godo.ListOptions
+	}
+	recordsByNameReturns struct {
+		result1 []godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}
+	recordsByNameReturnsOnCall map[int]struct {
+		result1 []godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeDomainService) Create(arg1 context.Context, arg2 *godo.DomainCreateRequest) (*godo.Domain, *godo.Response, error) {
+	fake.createMutex.Lock()
+	ret, specificReturn := fake.createReturnsOnCall[len(fake.createArgsForCall)]
+	fake.createArgsForCall = append(fake.createArgsForCall, struct {
+		arg1 context.Context
+		arg2 *godo.DomainCreateRequest
+	}{arg1, arg2})
+	stub := fake.CreateStub
+	fakeReturns := fake.createReturns
+	fake.recordInvocation("Create", []interface{}{arg1, arg2})
+	fake.createMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeDomainService) CreateCallCount() int {
+	fake.createMutex.RLock()
+	defer fake.createMutex.RUnlock()
+	return len(fake.createArgsForCall)
+}
+
+func (fake *FakeDomainService) CreateCalls(stub func(context.Context, *godo.DomainCreateRequest) (*godo.Domain, *godo.Response, error)) {
+	fake.createMutex.Lock()
+	defer fake.createMutex.Unlock()
+	fake.CreateStub = stub
+}
+
+func (fake *FakeDomainService) CreateArgsForCall(i int) (context.Context, *godo.DomainCreateRequest) {
+	fake.createMutex.RLock()
+	defer fake.createMutex.RUnlock()
+	argsForCall := fake.createArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeDomainService) CreateReturns(result1 *godo.Domain, result2 *godo.Response, result3 error) {
+	fake.createMutex.Lock()
+	defer fake.createMutex.Unlock()
+	fake.CreateStub = nil
+	fake.createReturns = struct {
+		result1 *godo.Domain
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDomainService) CreateReturnsOnCall(i int, result1 *godo.Domain, result2 *godo.Response, result3 error) {
+	fake.createMutex.Lock()
+	defer fake.createMutex.Unlock()
+	fake.CreateStub = nil
+	if fake.createReturnsOnCall == nil {
+		fake.createReturnsOnCall = make(map[int]struct {
+			result1 *godo.Domain
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.createReturnsOnCall[i] = struct {
+		result1 *godo.Domain
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDomainService) CreateRecord(arg1 context.Context, arg2 string, arg3 *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error) {
+	fake.createRecordMutex.Lock()
+	ret, specificReturn := fake.createRecordReturnsOnCall[len(fake.createRecordArgsForCall)]
+	fake.createRecordArgsForCall = append(fake.createRecordArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 *godo.DomainRecordEditRequest
+	}{arg1, arg2, arg3})
+	stub := fake.CreateRecordStub
+	fakeReturns := fake.createRecordReturns
+	fake.recordInvocation("CreateRecord", []interface{}{arg1, arg2, arg3})
+	fake.createRecordMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeDomainService) CreateRecordCallCount() int {
+	fake.createRecordMutex.RLock()
+	defer fake.createRecordMutex.RUnlock()
+	return len(fake.createRecordArgsForCall)
+}
+
+func (fake *FakeDomainService) CreateRecordCalls(stub func(context.Context, string, *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error)) {
+	fake.createRecordMutex.Lock()
+	defer fake.createRecordMutex.Unlock()
+	fake.CreateRecordStub = stub
+}
+
+func (fake *FakeDomainService) CreateRecordArgsForCall(i int) (context.Context, string, *godo.DomainRecordEditRequest) {
+	fake.createRecordMutex.RLock()
+	defer fake.createRecordMutex.RUnlock()
+	argsForCall := fake.createRecordArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeDomainService) CreateRecordReturns(result1 *godo.DomainRecord, result2 *godo.Response, result3 error) {
+	fake.createRecordMutex.Lock()
+	defer fake.createRecordMutex.Unlock()
+	fake.CreateRecordStub = nil
+	fake.createRecordReturns = struct {
+		result1 *godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDomainService) CreateRecordReturnsOnCall(i int, result1 *godo.DomainRecord, result2 *godo.Response, result3 error) {
+	fake.createRecordMutex.Lock()
+	defer fake.createRecordMutex.Unlock()
+	fake.CreateRecordStub = nil
+	if fake.createRecordReturnsOnCall == nil {
+		fake.createRecordReturnsOnCall = make(map[int]struct {
+			result1 *godo.DomainRecord
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.createRecordReturnsOnCall[i] = struct {
+		result1 *godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDomainService) Delete(arg1 context.Context, arg2 string) (*godo.Response, error) {
+	fake.deleteMutex.Lock()
+	ret, specificReturn := fake.deleteReturnsOnCall[len(fake.deleteArgsForCall)]
+	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.DeleteStub
+	fakeReturns := fake.deleteReturns
+	fake.recordInvocation("Delete", []interface{}{arg1, arg2})
+	fake.deleteMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDomainService) DeleteCallCount() int {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	return len(fake.deleteArgsForCall)
+}
+
+func (fake *FakeDomainService) DeleteCalls(stub func(context.Context, string) (*godo.Response, error)) {
+	fake.deleteMutex.Lock()
+	defer fake.deleteMutex.Unlock()
+	fake.DeleteStub = stub
+}
+
+func (fake *FakeDomainService) DeleteArgsForCall(i int) (context.Context, string) {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	argsForCall := fake.deleteArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeDomainService) DeleteReturns(result1 *godo.Response, result2 error) {
+	fake.deleteMutex.Lock()
+	defer fake.deleteMutex.Unlock()
+	fake.DeleteStub = nil
+	fake.deleteReturns = struct {
+		result1 *godo.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDomainService) DeleteReturnsOnCall(i int, result1 *godo.Response, result2 error) {
+	fake.deleteMutex.Lock()
+	defer fake.deleteMutex.Unlock()
+	fake.DeleteStub = nil
+	if fake.deleteReturnsOnCall == nil {
+		fake.deleteReturnsOnCall = make(map[int]struct {
+			result1 *godo.Response
+			result2 error
+		})
+	}
+	fake.deleteReturnsOnCall[i] = struct {
+		result1 *godo.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDomainService) DeleteRecord(arg1 context.Context, arg2 string, arg3 int) (*godo.Response, error) {
+	fake.deleteRecordMutex.Lock()
+	ret, specificReturn := fake.deleteRecordReturnsOnCall[len(fake.deleteRecordArgsForCall)]
+	fake.deleteRecordArgsForCall = append(fake.deleteRecordArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 int
+	}{arg1, arg2, arg3})
+	stub := fake.DeleteRecordStub
+	fakeReturns := fake.deleteRecordReturns
+	fake.recordInvocation("DeleteRecord", []interface{}{arg1, arg2, arg3})
+	fake.deleteRecordMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDomainService) DeleteRecordCallCount() int {
+	fake.deleteRecordMutex.RLock()
+	defer fake.deleteRecordMutex.RUnlock()
+	return len(fake.deleteRecordArgsForCall)
+}
+
+func (fake *FakeDomainService) DeleteRecordCalls(stub func(context.Context, string, int) (*godo.Response, error)) {
+	fake.deleteRecordMutex.Lock()
+	defer fake.deleteRecordMutex.Unlock()
+	fake.DeleteRecordStub = stub
+}
+
+func (fake *FakeDomainService) DeleteRecordArgsForCall(i int) (context.Context, string, int) {
+	fake.deleteRecordMutex.RLock()
+	defer fake.deleteRecordMutex.RUnlock()
+	argsForCall := fake.deleteRecordArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeDomainService) DeleteRecordReturns(result1 *godo.Response, result2 error) {
+	fake.deleteRecordMutex.Lock()
+	defer fake.deleteRecordMutex.Unlock()
+	fake.DeleteRecordStub = nil
+	fake.deleteRecordReturns = struct {
+		result1 *godo.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDomainService) DeleteRecordReturnsOnCall(i int, result1 *godo.Response, result2 error) {
+	fake.deleteRecordMutex.Lock()
+	defer fake.deleteRecordMutex.Unlock()
+	fake.DeleteRecordStub = nil
+	if fake.deleteRecordReturnsOnCall == nil {
+		fake.deleteRecordReturnsOnCall = make(map[int]struct {
+			result1 *godo.Response
+			result2 error
+		})
+	}
+	fake.deleteRecordReturnsOnCall[i] = struct {
+		result1 *godo.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDomainService) RecordsByName(arg1 context.Context, arg2 string, arg3 string, arg4 *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+	fake.recordsByNameMutex.Lock()
+	ret, specificReturn := fake.recordsByNameReturnsOnCall[len(fake.recordsByNameArgsForCall)]
+	fake.recordsByNameArgsForCall = append(fake.recordsByNameArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+		arg4 *godo.ListOptions
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.RecordsByNameStub
+	fakeReturns := fake.recordsByNameReturns
+	fake.recordInvocation("RecordsByName", []interface{}{arg1, arg2, arg3, arg4})
+	fake.recordsByNameMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeDomainService) RecordsByNameCallCount() int {
+	fake.recordsByNameMutex.RLock()
+	defer fake.recordsByNameMutex.RUnlock()
+	return len(fake.recordsByNameArgsForCall)
+}
+
+func (fake *FakeDomainService) RecordsByNameCalls(stub func(context.Context, string, string, *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error)) {
+	fake.recordsByNameMutex.Lock()
+	defer fake.recordsByNameMutex.Unlock()
+	fake.RecordsByNameStub = stub
+}
+
+func (fake *FakeDomainService) RecordsByNameArgsForCall(i int) (context.Context, string, string, *godo.ListOptions) {
+	fake.recordsByNameMutex.RLock()
+	defer fake.recordsByNameMutex.RUnlock()
+	argsForCall := fake.recordsByNameArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeDomainService) RecordsByNameReturns(result1 []godo.DomainRecord, result2 *godo.Response, result3 error) {
+	fake.recordsByNameMutex.Lock()
+	defer fake.recordsByNameMutex.Unlock()
+	fake.RecordsByNameStub = nil
+	fake.recordsByNameReturns = struct {
+		result1 []godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDomainService) RecordsByNameReturnsOnCall(i int, result1 []godo.DomainRecord, result2 *godo.Response, result3 error) {
+	fake.recordsByNameMutex.Lock()
+	defer fake.recordsByNameMutex.Unlock()
+	fake.RecordsByNameStub = nil
+	if fake.recordsByNameReturnsOnCall == nil {
+		fake.recordsByNameReturnsOnCall = make(map[int]struct {
+			result1 []godo.DomainRecord
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.recordsByNameReturnsOnCall[i] = struct {
+		result1 []godo.DomainRecord
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeDomainService) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeDomainService) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ doservice.DomainService = new(FakeDomainService)
@@ -0,0 +1,286 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package doservicefakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
+)
+
+type FakeKeyService struct {
+	CreateStub        func(context.Context, *godo.KeyCreateRequest) (*godo.Key, *godo.Response, error)
+	createMutex       sync.RWMutex
+	createArgsForCall []struct {
+		arg1 context.Context
+		arg2 *godo.KeyCreateRequest
+	}
+	createReturns struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}
+	createReturnsOnCall map[int]struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}
+	DeleteByIDStub        func(context.Context, int) (*godo.Response, error)
+	deleteByIDMutex       sync.RWMutex
+	deleteByIDArgsForCall []struct {
+		arg1 context.Context
+		arg2 int
+	}
+	deleteByIDReturns struct {
+		result1 *godo.Response
+		result2 error
+	}
+	deleteByIDReturnsOnCall map[int]struct {
+		result1 *godo.Response
+		result2 error
+	}
+	GetByIDStub        func(context.Context, int) (*godo.Key, *godo.Response, error)
+	getByIDMutex       sync.RWMutex
+	getByIDArgsForCall []struct {
+		arg1 context.Context
+		arg2 int
+	}
+	getByIDReturns struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}
+	getByIDReturnsOnCall map[int]struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeKeyService) Create(arg1 context.Context, arg2 *godo.KeyCreateRequest) (*godo.Key, *godo.Response, error) {
+	fake.createMutex.Lock()
+	ret, specificReturn := fake.createReturnsOnCall[len(fake.createArgsForCall)]
+	fake.createArgsForCall = append(fake.createArgsForCall, struct {
+		arg1 context.Context
+		arg2 *godo.KeyCreateRequest
+	}{arg1, arg2})
+	stub := fake.CreateStub
+	fakeReturns := fake.createReturns
+	fake.recordInvocation("Create", []interface{}{arg1, arg2})
+	fake.createMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeKeyService) CreateCallCount() int {
+	fake.createMutex.RLock()
+	defer fake.createMutex.RUnlock()
+	return len(fake.createArgsForCall)
+}
+
+func (fake *FakeKeyService) CreateCalls(stub func(context.Context, *godo.KeyCreateRequest) (*godo.Key, *godo.Response, error)) {
+	fake.createMutex.Lock()
+	defer fake.createMutex.Unlock()
+	fake.CreateStub = stub
+}
+
+func (fake *FakeKeyService) CreateArgsForCall(i int) (context.Context, *godo.KeyCreateRequest) {
+	fake.createMutex.RLock()
+	defer fake.createMutex.RUnlock()
+	argsForCall := fake.createArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKeyService) CreateReturns(result1 *godo.Key, result2 *godo.Response, result3 error) {
+	fake.createMutex.Lock()
+	defer fake.createMutex.Unlock()
+	fake.CreateStub = nil
+	fake.createReturns = struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKeyService) CreateReturnsOnCall(i int, result1 *godo.Key, result2 *godo.Response, result3 error) {
+	fake.createMutex.Lock()
+	defer fake.createMutex.Unlock()
+	fake.CreateStub = nil
+	if fake.createReturnsOnCall == nil {
+		fake.createReturnsOnCall = make(map[int]struct {
+			result1 *godo.Key
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.createReturnsOnCall[i] = struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKeyService) DeleteByID(arg1 context.Context, arg2 int) (*godo.Response, error) {
+	fake.deleteByIDMutex.Lock()
+	ret, specificReturn := fake.deleteByIDReturnsOnCall[len(fake.deleteByIDArgsForCall)]
+	fake.deleteByIDArgsForCall = append(fake.deleteByIDArgsForCall, struct {
+		arg1 context.Context
+		arg2 int
+	}{arg1, arg2})
+	stub := fake.DeleteByIDStub
+	fakeReturns := fake.deleteByIDReturns
+	fake.recordInvocation("DeleteByID", []interface{}{arg1, arg2})
+	fake.deleteByIDMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeKeyService) DeleteByIDCallCount() int {
+	fake.deleteByIDMutex.RLock()
+	defer fake.deleteByIDMutex.RUnlock()
+	return len(fake.deleteByIDArgsForCall)
+}
+
+func (fake *FakeKeyService) DeleteByIDCalls(stub func(context.Context, int) (*godo.Response, error)) {
+	fake.deleteByIDMutex.Lock()
+	defer fake.deleteByIDMutex.Unlock()
+	fake.DeleteByIDStub = stub
+}
+
+func (fake *FakeKeyService) DeleteByIDArgsForCall(i int) (context.Context, int) {
+	fake.deleteByIDMutex.RLock()
+	defer fake.deleteByIDMutex.RUnlock()
+	argsForCall := fake.deleteByIDArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKeyService) DeleteByIDReturns(result1 *godo.Response, result2 error) {
+	fake.deleteByIDMutex.Lock()
+	defer fake.deleteByIDMutex.Unlock()
+	fake.DeleteByIDStub = nil
+	fake.deleteByIDReturns = struct {
+		result1 *godo.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeKeyService) DeleteByIDReturnsOnCall(i int, result1 *godo.Response, result2 error) {
+	fake.deleteByIDMutex.Lock()
+	defer fake.deleteByIDMutex.Unlock()
+	fake.DeleteByIDStub = nil
+	if fake.deleteByIDReturnsOnCall == nil {
+		fake.deleteByIDReturnsOnCall = make(map[int]struct {
+			result1 *godo.Response
+			result2 error
+		})
+	}
+	fake.deleteByIDReturnsOnCall[i] = struct {
+		result1 *godo.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeKeyService) GetByID(arg1 context.Context, arg2 int) (*godo.Key, *godo.Response, error) {
+	fake.getByIDMutex.Lock()
+	ret, specificReturn := fake.getByIDReturnsOnCall[len(fake.getByIDArgsForCall)]
+	fake.getByIDArgsForCall = append(fake.getByIDArgsForCall, struct {
+		arg1 context.Context
+		arg2 int
+	}{arg1, arg2})
+	stub := fake.GetByIDStub
+	fakeReturns := fake.getByIDReturns
+	fake.recordInvocation("GetByID", []interface{}{arg1, arg2})
+	fake.getByIDMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeKeyService) GetByIDCallCount() int {
+	fake.getByIDMutex.RLock()
+	defer fake.getByIDMutex.RUnlock()
+	return len(fake.getByIDArgsForCall)
+}
+
+func (fake *FakeKeyService) GetByIDCalls(stub func(context.Context, int) (*godo.Key, *godo.Response, error)) {
+	fake.getByIDMutex.Lock()
+	defer fake.getByIDMutex.Unlock()
+	fake.GetByIDStub = stub
+}
+
+func (fake *FakeKeyService) GetByIDArgsForCall(i int) (context.Context, int) {
+	fake.getByIDMutex.RLock()
+	defer fake.getByIDMutex.RUnlock()
+	argsForCall := fake.getByIDArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKeyService) GetByIDReturns(result1 *godo.Key, result2 *godo.Response, result3 error) {
+	fake.getByIDMutex.Lock()
+	defer fake.getByIDMutex.Unlock()
+	fake.GetByIDStub = nil
+	fake.getByIDReturns = struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKeyService) GetByIDReturnsOnCall(i int, result1 *godo.Key, result2 *godo.Response, result3 error) {
+	fake.getByIDMutex.Lock()
+	defer fake.getByIDMutex.Unlock()
+	fake.GetByIDStub = nil
+	if fake.getByIDReturnsOnCall == nil {
+		fake.getByIDReturnsOnCall = make(map[int]struct {
+			result1 *godo.Key
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.getByIDReturnsOnCall[i] = struct {
+		result1 *godo.Key
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKeyService) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeKeyService) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ doservice.KeyService = new(FakeKeyService)
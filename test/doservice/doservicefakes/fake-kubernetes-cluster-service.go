@@ -0,0 +1,207 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package doservicefakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
+)
+
+type FakeKubernetesClusterService struct {
+	GetKubeConfigStub        func(context.Context, string) (*godo.KubernetesClusterConfig, *godo.Response, error)
+	getKubeConfigMutex       sync.RWMutex
+	getKubeConfigArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+	}
+	getKubeConfigReturns struct {
+		result1 *godo.KubernetesClusterConfig
+		result2 *godo.Response
+		result3 error
+	}
+	getKubeConfigReturnsOnCall map[int]struct {
+		result1 *godo.KubernetesClusterConfig
+		result2 *godo.Response
+		result3 error
+	}
+	ListStub        func(context.Context, *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error)
+	listMutex       sync.RWMutex
+	listArgsForCall []struct {
+		arg1 context.Context
+		arg2 *godo.ListOptions
+	}
+	listReturns struct {
+		result1 []*godo.KubernetesCluster
+		result2 *godo.Response
+		result3 error
+	}
+	listReturnsOnCall map[int]struct {
+		result1 []*godo.KubernetesCluster
+		result2 *godo.Response
+		result3 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeKubernetesClusterService) GetKubeConfig(arg1 context.Context, arg2 string) (*godo.KubernetesClusterConfig, *godo.Response, error) {
+	fake.getKubeConfigMutex.Lock()
+	ret, specificReturn := fake.getKubeConfigReturnsOnCall[len(fake.getKubeConfigArgsForCall)]
+	fake.getKubeConfigArgsForCall = append(fake.getKubeConfigArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.GetKubeConfigStub
+	fakeReturns := fake.getKubeConfigReturns
+	fake.recordInvocation("GetKubeConfig", []interface{}{arg1, arg2})
+	fake.getKubeConfigMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeKubernetesClusterService) GetKubeConfigCallCount() int {
+	fake.getKubeConfigMutex.RLock()
+	defer fake.getKubeConfigMutex.RUnlock()
+	return len(fake.getKubeConfigArgsForCall)
+}
+
+func (fake *FakeKubernetesClusterService) GetKubeConfigCalls(stub func(context.Context, string) (*godo.KubernetesClusterConfig, *godo.Response, error)) {
+	fake.getKubeConfigMutex.Lock()
+	defer fake.getKubeConfigMutex.Unlock()
+	fake.GetKubeConfigStub = stub
+}
+
+func (fake *FakeKubernetesClusterService) GetKubeConfigArgsForCall(i int) (context.Context, string) {
+	fake.getKubeConfigMutex.RLock()
+	defer fake.getKubeConfigMutex.RUnlock()
+	argsForCall := fake.getKubeConfigArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKubernetesClusterService) GetKubeConfigReturns(result1 *godo.KubernetesClusterConfig, result2 *godo.Response, result3 error) {
+	fake.getKubeConfigMutex.Lock()
+	defer fake.getKubeConfigMutex.Unlock()
+	fake.GetKubeConfigStub = nil
+	fake.getKubeConfigReturns = struct {
+		result1 *godo.KubernetesClusterConfig
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKubernetesClusterService) GetKubeConfigReturnsOnCall(i int, result1 *godo.KubernetesClusterConfig, result2 *godo.Response, result3 error) {
+	fake.getKubeConfigMutex.Lock()
+	defer fake.getKubeConfigMutex.Unlock()
+	fake.GetKubeConfigStub = nil
+	if fake.getKubeConfigReturnsOnCall == nil {
+		fake.getKubeConfigReturnsOnCall = make(map[int]struct {
+			result1 *godo.KubernetesClusterConfig
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.getKubeConfigReturnsOnCall[i] = struct {
+		result1 *godo.KubernetesClusterConfig
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKubernetesClusterService) List(arg1 context.Context, arg2 *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error) {
+	fake.listMutex.Lock()
+	ret, specificReturn := fake.listReturnsOnCall[len(fake.listArgsForCall)]
+	fake.listArgsForCall = append(fake.listArgsForCall, struct {
+		arg1 context.Context
+		arg2 *godo.ListOptions
+	}{arg1, arg2})
+	stub := fake.ListStub
+	fakeReturns := fake.listReturns
+	fake.recordInvocation("List", []interface{}{arg1, arg2})
+	fake.listMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeKubernetesClusterService) ListCallCount() int {
+	fake.listMutex.RLock()
+	defer fake.listMutex.RUnlock()
+	return len(fake.listArgsForCall)
+}
+
+func (fake *FakeKubernetesClusterService) ListCalls(stub func(context.Context, *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error)) {
+	fake.listMutex.Lock()
+	defer fake.listMutex.Unlock()
+	fake.ListStub = stub
+}
+
+func (fake *FakeKubernetesClusterService) ListArgsForCall(i int) (context.Context, *godo.ListOptions) {
+	fake.listMutex.RLock()
+	defer fake.listMutex.RUnlock()
+	argsForCall := fake.listArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKubernetesClusterService) ListReturns(result1 []*godo.KubernetesCluster, result2 *godo.Response, result3 error) {
+	fake.listMutex.Lock()
+	defer fake.listMutex.Unlock()
+	fake.ListStub = nil
+	fake.listReturns = struct {
+		result1 []*godo.KubernetesCluster
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKubernetesClusterService) ListReturnsOnCall(i int, result1 []*godo.KubernetesCluster, result2 *godo.Response, result3 error) {
+	fake.listMutex.Lock()
+	defer fake.listMutex.Unlock()
+	fake.ListStub = nil
+	if fake.listReturnsOnCall == nil {
+		fake.listReturnsOnCall = make(map[int]struct {
+			result1 []*godo.KubernetesCluster
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.listReturnsOnCall[i] = struct {
+		result1 []*godo.KubernetesCluster
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeKubernetesClusterService) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeKubernetesClusterService) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ doservice.KubernetesClusterService = new(FakeKubernetesClusterService)
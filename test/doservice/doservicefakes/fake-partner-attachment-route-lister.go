@@ -0,0 +1,209 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package doservicefakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
+)
+
+type FakePartnerAttachmentRouteLister struct {
+	ListStub        func(context.Context, *godo.ListOptions) ([]*godo.PartnerAttachment, *godo.Response, error)
+	listMutex       sync.RWMutex
+	listArgsForCall []struct {
+		arg1 context.Context
+		arg2 *godo.ListOptions
+	}
+	listReturns struct {
+		result1 []*godo.PartnerAttachment
+		result2 *godo.Response
+		result3 error
+	}
+	listReturnsOnCall map[int]struct {
+		result1 []*godo.PartnerAttachment
+		result2 *godo.Response
+		result3 error
+	}
+	ListRoutesStub        func(context.Context, string, *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error)
+	listRoutesMutex       sync.RWMutex
+	listRoutesArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 *godo.ListOptions
+	}
+	listRoutesReturns struct {
+		result1 []*godo.RemoteRoute
+		result2 *godo.Response
+		result3 error
+	}
+	listRoutesReturnsOnCall map[int]struct {
+		result1 []*godo.RemoteRoute
+		result2 *godo.Response
+		result3 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakePartnerAttachmentRouteLister) List(arg1 context.Context, arg2 *godo.ListOptions) ([]*godo.PartnerAttachment, *godo.Response, error) {
+	fake.listMutex.Lock()
+	ret, specificReturn := fake.listReturnsOnCall[len(fake.listArgsForCall)]
+	fake.listArgsForCall = append(fake.listArgsForCall, struct {
+		arg1 context.Context
+		arg2 *godo.ListOptions
+	}{arg1, arg2})
+	stub := fake.ListStub
+	fakeReturns := fake.listReturns
+	fake.recordInvocation("List", []interface{}{arg1, arg2})
+	fake.listMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListCallCount() int {
+	fake.listMutex.RLock()
+	defer fake.listMutex.RUnlock()
+	return len(fake.listArgsForCall)
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListCalls(stub func(context.Context, *godo.ListOptions) ([]*godo.PartnerAttachment, *godo.Response, error)) {
+	fake.listMutex.Lock()
+	defer fake.listMutex.Unlock()
+	fake.ListStub = stub
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListArgsForCall(i int) (context.Context, *godo.ListOptions) {
+	fake.listMutex.RLock()
+	defer fake.listMutex.RUnlock()
+	argsForCall := fake.listArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListReturns(result1 []*godo.PartnerAttachment, result2 *godo.Response, result3 error) {
+	fake.listMutex.Lock()
+	defer fake.listMutex.Unlock()
+	fake.ListStub = nil
+	fake.listReturns = struct {
+		result1 []*godo.PartnerAttachment
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListReturnsOnCall(i int, result1 []*godo.PartnerAttachment, result2 *godo.Response, result3 error) {
+	fake.listMutex.Lock()
+	defer fake.listMutex.Unlock()
+	fake.ListStub = nil
+	if fake.listReturnsOnCall == nil {
+		fake.listReturnsOnCall = make(map[int]struct {
+			result1 []*godo.PartnerAttachment
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.listReturnsOnCall[i] = struct {
+		result1 []*godo.PartnerAttachment
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListRoutes(arg1 context.Context, arg2 string, arg3 *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error) {
+	fake.listRoutesMutex.Lock()
+	ret, specificReturn := fake.listRoutesReturnsOnCall[len(fake.listRoutesArgsForCall)]
+	fake.listRoutesArgsForCall = append(fake.listRoutesArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 *godo.ListOptions
+	}{arg1, arg2, arg3})
+	stub := fake.ListRoutesStub
+	fakeReturns := fake.listRoutesReturns
+	fake.recordInvocation("ListRoutes", []interface{}{arg1, arg2, arg3})
+	fake.listRoutesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListRoutesCallCount() int {
+	fake.listRoutesMutex.RLock()
+	defer fake.listRoutesMutex.RUnlock()
+	return len(fake.listRoutesArgsForCall)
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListRoutesCalls(stub func(context.Context, string, *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error)) {
+	fake.listRoutesMutex.Lock()
+	defer fake.listRoutesMutex.Unlock()
+	fake.ListRoutesStub = stub
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListRoutesArgsForCall(i int) (context.Context, string, *godo.ListOptions) {
+	fake.listRoutesMutex.RLock()
+	defer fake.listRoutesMutex.RUnlock()
+	argsForCall := fake.listRoutesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListRoutesReturns(result1 []*godo.RemoteRoute, result2 *godo.Response, result3 error) {
+	fake.listRoutesMutex.Lock()
+	defer fake.listRoutesMutex.Unlock()
+	fake.ListRoutesStub = nil
+	fake.listRoutesReturns = struct {
+		result1 []*godo.RemoteRoute
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakePartnerAttachmentRouteLister) ListRoutesReturnsOnCall(i int, result1 []*godo.RemoteRoute, result2 *godo.Response, result3 error) {
+	fake.listRoutesMutex.Lock()
+	defer fake.listRoutesMutex.Unlock()
+	fake.ListRoutesStub = nil
+	if fake.listRoutesReturnsOnCall == nil {
+		fake.listRoutesReturnsOnCall = make(map[int]struct {
+			result1 []*godo.RemoteRoute
+			result2 *godo.Response
+			result3 error
+		})
+	}
+	fake.listRoutesReturnsOnCall[i] = struct {
+		result1 []*godo.RemoteRoute
+		result2 *godo.Response
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakePartnerAttachmentRouteLister) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakePartnerAttachmentRouteLister) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ doservice.PartnerAttachmentRouteLister = new(FakePartnerAttachmentRouteLister)
@@ -0,0 +1,480 @@
+// Package fakedo is an in-process fake of the parts of the DigitalOcean API the test helpers use: VPCs, Kubernetes
+// clusters, SSH keys, domains and records, and Partner Network Connect attachments. It paginates lists and
+// returns links the way the real API does, so helpers can be tested against godo without network access:
+//
+//	server := fakedo.NewServer(t)
+//	server.AddVPC(godo.VPC{Name: "existing", IPRange: "10.0.0.0/24"})
+//	client := helper.CreateGodoClientWithOptionsT(t, &helper.GodoClientOptions{BaseURL: server.URL, Token: fakedo.Token})
+package fakedo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// Token is the only API token the server accepts.
+const Token = "fakedo-token"
+
+// DefaultPageSize is the number of items in each page of a list when the request does not set per_page.
+const DefaultPageSize = 20
+
+// Server is a fake DigitalOcean API. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	nextID      int
+	vpcs        []*godo.VPC
+	clusters    []*godo.KubernetesCluster
+	kubeconfigs map[string][]byte // Keyed by cluster ID
+	keys        []*godo.Key
+	domains     []*godo.Domain
+	records     map[string][]*godo.DomainRecord // Keyed by domain name
+	attachments []*godo.PartnerAttachment
+	routes      map[string][]*godo.RemoteRoute // Keyed by attachment ID
+	requests    []string                       // Method and path of every request
+}
+
+// NewServer starts a fake DigitalOcean API that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		nextID:      1000,
+		kubeconfigs: map[string][]byte{},
+		records:     map[string][]*godo.DomainRecord{},
+		routes:      map[string][]*godo.RemoteRoute{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/vpcs", s.listVPCs)
+	mux.HandleFunc("GET /v2/kubernetes/clusters", s.listClusters)
+	mux.HandleFunc("GET /v2/kubernetes/clusters/{id}/kubeconfig", s.getKubeconfig)
+	mux.HandleFunc("GET /v2/account/keys", s.listKeys)
+	mux.HandleFunc("POST /v2/account/keys", s.createKey)
+	mux.HandleFunc("GET /v2/account/keys/{id}", s.getKey)
+	mux.HandleFunc("DELETE /v2/account/keys/{id}", s.deleteKey)
+	mux.HandleFunc("GET /v2/domains", s.listDomains)
+	mux.HandleFunc("POST /v2/domains", s.createDomain)
+	mux.HandleFunc("GET /v2/domains/{name}", s.getDomain)
+	mux.HandleFunc("DELETE /v2/domains/{name}", s.deleteDomain)
+	mux.HandleFunc("GET /v2/domains/{name}/records", s.listRecords)
+	mux.HandleFunc("POST /v2/domains/{name}/records", s.createRecord)
+	mux.HandleFunc("DELETE /v2/domains/{name}/records/{id}", s.deleteRecord)
+	mux.HandleFunc("GET /v2/partner_network_connect/attachments", s.listAttachments)
+	mux.HandleFunc("GET /v2/partner_network_connect/attachments/{id}/remote_routes", s.listRoutes)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+Token {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Unable to authenticate you")
+			return
+		}
+		w.Header().Set("RateLimit-Limit", "5000")
+		w.Header().Set("RateLimit-Remaining", "4999")
+		w.Header().Set("RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the method and path of every request received so far, e.g. "GET /v2/vpcs".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// newID returns a fresh numeric ID. s.mu must be held.
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// AddVPC adds a VPC, assigning it an ID if it has none.
+func (s *Server) AddVPC(vpc godo.VPC) *godo.VPC {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if vpc.ID == "" {
+		vpc.ID = fmt.Sprintf("vpc-%d", s.newID())
+	}
+	s.vpcs = append(s.vpcs, &vpc)
+	return &vpc
+}
+
+// AddKubernetesCluster adds a DOKS cluster whose kubeconfig is kubeconfig, assigning it an ID if it has none.
+func (s *Server) AddKubernetesCluster(cluster godo.KubernetesCluster, kubeconfig []byte) *godo.KubernetesCluster {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cluster.ID == "" {
+		cluster.ID = fmt.Sprintf("cluster-%d", s.newID())
+	}
+	s.clusters = append(s.clusters, &cluster)
+	s.kubeconfigs[cluster.ID] = kubeconfig
+	return &cluster
+}
+
+// AddDomain adds a domain with no records.
+func (s *Server) AddDomain(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domains = append(s.domains, &godo.Domain{Name: name, TTL: 1800})
+}
+
+// AddPartnerAttachment adds a Partner Network Connect attachment advertising routes,
+// assigning it an ID if it has none.
+func (s *Server) AddPartnerAttachment(attachment godo.PartnerAttachment, routes ...string) *godo.PartnerAttachment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attachment.ID == "" {
+		attachment.ID = fmt.Sprintf("attachment-%d", s.newID())
+	}
+	s.attachments = append(s.attachments, &attachment)
+	for _, cidr := range routes {
+		s.routes[attachment.ID] = append(s.routes[attachment.ID], &godo.RemoteRoute{Cidr: cidr})
+	}
+	return &attachment
+}
+
+// Keys returns the SSH keys in the account.
+func (s *Server) Keys() []godo.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]godo.Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *key)
+	}
+	return keys
+}
+
+// Domains returns the names of the domains in the account.
+func (s *Server) Domains() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.domains))
+	for _, domain := range s.domains {
+		names = append(names, domain.Name)
+	}
+	return names
+}
+
+// Records returns the records in domain.
+func (s *Server) Records(domain string) []godo.DomainRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]godo.DomainRecord, 0, len(s.records[domain]))
+	for _, record := range s.records[domain] {
+		records = append(records, *record)
+	}
+	return records
+}
+
+func (s *Server) listVPCs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeList(w, r, "vpcs", s.vpcs)
+}
+
+func (s *Server) listClusters(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeList(w, r, "kubernetes_clusters", s.clusters)
+}
+
+func (s *Server) getKubeconfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kubeconfig, ok := s.kubeconfigs[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(kubeconfig)
+}
+
+func (s *Server) listKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeList(w, r, "ssh_keys", s.keys)
+}
+
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	var req godo.KeyCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	if req.Name == "" || req.PublicKey == "" {
+		writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", "name and public_key are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.keys {
+		if key.PublicKey == req.PublicKey {
+			writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", "SSH Key is already in use on your account")
+			return
+		}
+	}
+	key := &godo.Key{ID: s.newID(), Name: req.Name, PublicKey: req.PublicKey, Fingerprint: fmt.Sprintf("fake:%d", s.nextID)}
+	s.keys = append(s.keys, key)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"ssh_key": key})
+}
+
+// findKey returns the index of the key with the numeric ID in the request path, or -1. s.mu must be held.
+func (s *Server) findKey(r *http.Request) int {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return -1
+	}
+	for i, key := range s.keys {
+		if key.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) getKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findKey(r)
+	if i < 0 {
+		writeNotFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ssh_key": s.keys[i]})
+}
+
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findKey(r)
+	if i < 0 {
+		writeNotFound(w)
+		return
+	}
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listDomains(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeList(w, r, "domains", s.domains)
+}
+
+// findDomain returns the index of the domain named in the request path, or -1. s.mu must be held.
+func (s *Server) findDomain(r *http.Request) int {
+	for i, domain := range s.domains {
+		if domain.Name == r.PathValue("name") {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) createDomain(w http.ResponseWriter, r *http.Request) {
+	var req godo.DomainCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, domain := range s.domains {
+		if domain.Name == req.Name {
+			writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", "Name already exists")
+			return
+		}
+	}
+	domain := &godo.Domain{Name: req.Name, TTL: 1800}
+	s.domains = append(s.domains, domain)
+	// Like the real API, a new domain starts with its SOA and NS records
+	s.records[req.Name] = []*godo.DomainRecord{{ID: s.newID(), Type: "SOA", Name: "@", Data: "1800", TTL: 1800}}
+	for i := 1; i < 4; i++ {
+		s.records[req.Name] = append(s.records[req.Name], &godo.DomainRecord{
+			ID: s.newID(), Type: "NS", Name: "@", Data: fmt.Sprintf("ns%d.digitalocean.com", i), TTL: 1800,
+		})
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"domain": domain})
+}
+
+func (s *Server) getDomain(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findDomain(r)
+	if i < 0 {
+		writeNotFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"domain": s.domains[i]})
+}
+
+func (s *Server) deleteDomain(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findDomain(r)
+	if i < 0 {
+		writeNotFound(w)
+		return
+	}
+	delete(s.records, s.domains[i].Name)
+	s.domains = append(s.domains[:i], s.domains[i+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listRecords lists the records of a domain, filtered by the name (a fully qualified name) and type query parameters.
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findDomain(r) < 0 {
+		writeNotFound(w)
+		return
+	}
+	domain := r.PathValue("name")
+	name, recordType := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+	var records []*godo.DomainRecord
+	for _, record := range s.records[domain] {
+		fqdn := domain
+		if record.Name != "@" {
+			fqdn = record.Name + "." + domain
+		}
+		if (name == "" || name == fqdn) && (recordType == "" || recordType == record.Type) {
+			records = append(records, record)
+		}
+	}
+	writeList(w, r, "domain_records", records)
+}
+
+func (s *Server) createRecord(w http.ResponseWriter, r *http.Request) {
+	var req godo.DomainRecordEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findDomain(r) < 0 {
+		writeNotFound(w)
+		return
+	}
+	record := &godo.DomainRecord{
+		ID: s.newID(), Type: req.Type, Name: req.Name, Data: req.Data, TTL: req.TTL,
+		Priority: req.Priority, Port: req.Port, Weight: req.Weight, Flags: req.Flags, Tag: req.Tag,
+	}
+	domain := r.PathValue("name")
+	s.records[domain] = append(s.records[domain], record)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"domain_record": record})
+}
+
+func (s *Server) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	domain := r.PathValue("name")
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	for i, record := range s.records[domain] {
+		if record.ID == id {
+			s.records[domain] = append(s.records[domain][:i], s.records[domain][i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeNotFound(w)
+}
+
+func (s *Server) listAttachments(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeList(w, r, "partner_attachments", s.attachments)
+}
+
+func (s *Server) listRoutes(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	for _, attachment := range s.attachments {
+		if attachment.ID == id {
+			writeList(w, r, "remote_routes", s.routes[id])
+			return
+		}
+	}
+	writeNotFound(w)
+}
+
+// writeList writes the page of items selected by the page and per_page query parameters under key,
+// with links to the other pages and the total in meta, as the real API does.
+func writeList[T any](w http.ResponseWriter, r *http.Request, key string, items []T) {
+	query := r.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = DefaultPageSize
+	}
+	lastPage := max(1, (len(items)+perPage-1)/perPage)
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	pageItems := items[start:end]
+	if pageItems == nil {
+		pageItems = []T{}
+	}
+
+	pageURL := func(p int) string {
+		u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("page", strconv.Itoa(p))
+		q.Set("per_page", strconv.Itoa(perPage))
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	pages := &godo.Pages{}
+	if page > 1 {
+		pages.First = pageURL(1)
+		pages.Prev = pageURL(page - 1)
+	}
+	if page < lastPage {
+		pages.Next = pageURL(page + 1)
+		pages.Last = pageURL(lastPage)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		key:     pageItems,
+		"links": &godo.Links{Pages: pages},
+		"meta":  &godo.Meta{Total: len(items)},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, id, message string) {
+	writeJSON(w, status, map[string]string{"id": id, "message": message})
+}
+
+func writeNotFound(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, "not_found", "The resource you were accessing could not be found.")
+}
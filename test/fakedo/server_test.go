@@ -0,0 +1,100 @@
+package fakedo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func newClient(t *testing.T, server *Server, token string) *godo.Client {
+	httpClient := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	client, err := godo.New(httpClient, godo.SetBaseURL(server.URL+"/"))
+	require.NoError(t, err)
+	return client
+}
+
+func TestServer_Pagination(t *testing.T) {
+	server := NewServer(t)
+	for i := 0; i < 45; i++ {
+		server.AddVPC(godo.VPC{Name: fmt.Sprintf("vpc-%02d", i), IPRange: fmt.Sprintf("10.%d.0.0/24", i)})
+	}
+	client := newClient(t, server, Token)
+	ctx := context.Background()
+
+	vpcs, resp, err := client.VPCs.List(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, vpcs, DefaultPageSize)
+	assert.Equal(t, 45, resp.Meta.Total)
+	assert.False(t, resp.Links.IsLastPage())
+	current, err := resp.Links.CurrentPage()
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+
+	vpcs, resp, err = client.VPCs.List(ctx, &godo.ListOptions{Page: 3, PerPage: 20})
+	require.NoError(t, err)
+	require.Len(t, vpcs, 5)
+	assert.Equal(t, "vpc-40", vpcs[0].Name)
+	assert.True(t, resp.Links.IsLastPage())
+	current, err = resp.Links.CurrentPage()
+	require.NoError(t, err)
+	assert.Equal(t, 3, current)
+	assert.NotEmpty(t, resp.Links.Pages.Prev)
+
+	vpcs, resp, err = client.VPCs.List(ctx, &godo.ListOptions{Page: 9})
+	require.NoError(t, err)
+	assert.Empty(t, vpcs, "a page past the end is empty")
+	assert.Equal(t, 45, resp.Meta.Total)
+}
+
+func TestServer_RejectsBadToken(t *testing.T) {
+	server := NewServer(t)
+	_, resp, err := newClient(t, server, "wrong").VPCs.List(context.Background(), nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestServer_Keys(t *testing.T) {
+	server := NewServer(t)
+	client := newClient(t, server, Token)
+	ctx := context.Background()
+
+	key, _, err := client.Keys.Create(ctx, &godo.KeyCreateRequest{Name: "test", PublicKey: "ssh-ed25519 AAAA"})
+	require.NoError(t, err)
+	_, _, err = client.Keys.Create(ctx, &godo.KeyCreateRequest{Name: "again", PublicKey: "ssh-ed25519 AAAA"})
+	assert.Error(t, err, "a public key can only be added once")
+
+	got, _, err := client.Keys.GetByID(ctx, key.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "test", got.Name)
+
+	_, err = client.Keys.DeleteByID(ctx, key.ID)
+	require.NoError(t, err)
+	assert.Empty(t, server.Keys())
+
+	_, resp, err := client.Keys.GetByID(ctx, key.ID)
+	var errResp *godo.ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "The resource you were accessing could not be found.", errResp.Message)
+}
+
+func TestServer_PartnerAttachmentRoutes(t *testing.T) {
+	server := NewServer(t)
+	attachment := server.AddPartnerAttachment(godo.PartnerAttachment{Name: "pnc"}, "192.168.1.0/24", "192.168.2.0/24")
+	client := newClient(t, server, Token)
+
+	routes, resp, err := client.PartnerAttachment.ListRoutes(context.Background(), attachment.ID, &godo.ListOptions{PerPage: 1})
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	assert.Equal(t, "192.168.1.0/24", routes[0].Cidr)
+	assert.False(t, resp.Links.IsLastPage())
+
+	_, _, err = client.PartnerAttachment.ListRoutes(context.Background(), "missing", nil)
+	assert.Error(t, err)
+}
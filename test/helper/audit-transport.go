@@ -0,0 +1,200 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one line of the audit log: a create, update or delete call sent to the API.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`                  // When the request was sent
+	Test       string    `json:"test"`                  // Test that made the call (see GodoClientOptions.TestName)
+	Method     string    `json:"method"`                // POST, PUT, PATCH or DELETE
+	Path       string    `json:"path"`                  // e.g. /v2/account/keys/512189
+	ResourceID string    `json:"resource_id,omitempty"` // Created resource for a POST, the last path segment otherwise
+	Status     int       `json:"status,omitempty"`      // Response status, after any retries
+	Error      string    `json:"error,omitempty"`       // Set when no response was received
+}
+
+// auditLogMu serializes writes from every client in the process, so lines from parallel tests never interleave.
+var auditLogMu sync.Mutex
+
+// auditTransport is an http.RoundTripper that appends an AuditRecord to a JSONL file for every request that
+// creates, updates or deletes a resource. Reads are not recorded.
+type auditTransport struct {
+	base http.RoundTripper
+	path string
+	test string
+	now  func() time.Time
+}
+
+// newAuditTransport wraps base (http.DefaultTransport if nil) with an audit log at path, attributing calls to test.
+func newAuditTransport(base http.RoundTripper, path, test string) *auditTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &auditTransport{base: base, path: path, test: test, now: time.Now}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (at *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isMutating(req.Method) {
+		return at.base.RoundTrip(req)
+	}
+	record := AuditRecord{
+		Time:   at.now().UTC(),
+		Test:   at.test,
+		Method: req.Method,
+		Path:   req.URL.Path,
+	}
+	if req.Method != http.MethodPost {
+		record.ResourceID = path.Base(strings.TrimSuffix(req.URL.Path, "/"))
+	}
+	resp, err := at.base.RoundTrip(req)
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Status = resp.StatusCode
+		if req.Method == http.MethodPost {
+			record.ResourceID = createdResourceIDFromResponse(resp)
+		}
+	}
+	if err := at.write(record); err != nil {
+		// A broken audit log shouldn't fail the test
+		log.Printf("Unable to write audit log %s: %v", at.path, err)
+	}
+	return resp, err
+}
+
+// write appends record to the audit log as one line.
+func (at *auditTransport) write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+	if dir := filepath.Dir(at.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// O_APPEND keeps lines whole when test binaries of several packages share the file
+	f, err := os.OpenFile(at.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// createdResourceIDFromResponse returns the ID of the resource a successful POST created, read from the
+// response, e.g. {"ssh_key": {"id": 512189}}.
+func createdResourceIDFromResponse(resp *http.Response) string {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	// The caller still reads the response, so hand it back what was read, and the error if reading failed
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+	if err != nil {
+		return ""
+	}
+	return createdResourceID(body)
+}
+
+// createdResourceID returns the id, or failing that the name (as for domains), of the resources in a create
+// response. Bulk creates, such as several droplets at once, return a comma-separated list.
+func createdResourceID(body []byte) string {
+	type resource struct {
+		ID   json.RawMessage `json:"id"`
+		Name string          `json:"name"`
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return ""
+	}
+	var ids []string
+	for key, raw := range envelope {
+		if key == "links" || key == "meta" {
+			continue
+		}
+		var resources []resource
+		var single resource
+		if err := json.Unmarshal(raw, &single); err == nil {
+			resources = []resource{single}
+		} else if err := json.Unmarshal(raw, &resources); err != nil {
+			continue
+		}
+		for _, r := range resources {
+			if id := strings.Trim(string(r.ID), `"`); id != "" && id != "null" {
+				ids = append(ids, id)
+			} else if r.Name != "" {
+				ids = append(ids, r.Name)
+			}
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+// errReader returns err, or io.EOF if err is nil, once the bytes before it have been read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// isMutating reports whether a request with method may create, update or delete a resource.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// ReadAuditLogE returns the records in the audit log at path, oldest first.
+func ReadAuditLogE(path string) ([]AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("unable to parse audit log %s line %d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read audit log %s: %w", path, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/scale-with-simplicity/test/fakedo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateGodoClientWithOptions_AuditLog(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "audit", "godo.jsonl")
+	server := fakedo.NewServer(t)
+	server.AddDomain("example.com")
+	client := CreateGodoClientWithOptionsT(t, &GodoClientOptions{BaseURL: server.URL, Token: fakedo.Token, MaxRetries: -1, AuditLog: auditLog})
+
+	_, key := CreateSshKeyT(t, client.Keys, "audit-key")
+	_, err := CreateTestDomainE(client.Domains, "example.com", "audit")
+	require.NoError(t, err)
+	_, _, err = client.VPCs.List(context.Background(), nil)
+	require.NoError(t, err)
+	DeleteTestDomainT(t, client.Domains, "example.com", "audit")
+	DeleteSshKey(client, key.ID)
+
+	records, err := ReadAuditLogE(auditLog)
+	require.NoError(t, err)
+	keyID := strconv.Itoa(key.ID)
+	type call struct{ method, path, resourceID string }
+	var calls []call
+	for _, record := range records {
+		assert.Equal(t, t.Name(), record.Test)
+		assert.WithinDuration(t, time.Now(), record.Time, time.Minute)
+		assert.Less(t, record.Status, 300, "%s %s", record.Method, record.Path)
+		calls = append(calls, call{record.Method, record.Path, record.ResourceID})
+	}
+	require.Empty(t, server.Records("example.com"), "the NS records should have been deleted")
+	require.Len(t, calls, 10, "reads should not be audited")
+	assert.Equal(t, call{"POST", "/v2/account/keys", keyID}, calls[0])
+	assert.Equal(t, call{"POST", "/v2/domains", "audit.example.com"}, calls[1])
+	for _, c := range calls[2:5] {
+		assert.Equal(t, "POST", c.method)
+		assert.Equal(t, "/v2/domains/example.com/records", c.path)
+		assert.NotEmpty(t, c.resourceID)
+	}
+	assert.Equal(t, call{"DELETE", "/v2/domains/audit.example.com", "audit.example.com"}, calls[5])
+	for i, c := range calls[6:9] {
+		assert.Equal(t, call{"DELETE", "/v2/domains/example.com/records/" + calls[2+i].resourceID, calls[2+i].resourceID}, c)
+	}
+	assert.Equal(t, call{"DELETE", "/v2/account/keys/" + keyID, keyID}, calls[9])
+}
+
+// failingTransport fails every request with err
+type failingTransport struct {
+	err error
+}
+
+func (ft failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, ft.err
+}
+
+func TestAuditTransport_RecordsErrors(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "godo.jsonl")
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := newAuditTransport(failingTransport{errors.New("connection reset")}, auditLog, "TestLeak")
+	at.now = func() time.Time { return now }
+
+	req, err := http.NewRequest(http.MethodDelete, "https://api.digitalocean.com/v2/droplets/1234", nil)
+	require.NoError(t, err)
+	_, err = at.RoundTrip(req)
+	assert.EqualError(t, err, "connection reset")
+
+	data, err := os.ReadFile(auditLog)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"time":"2025-06-01T12:00:00Z","test":"TestLeak","method":"DELETE","path":"/v2/droplets/1234","resource_id":"1234","error":"connection reset"}`,
+		string(data))
+}
+
+func TestCreatedResourceID(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"Numeric ID", `{"ssh_key": {"id": 512189, "name": "key"}}`, "512189"},
+		{"UUID", `{"vpc": {"id": "5a4981aa-9653-4bd1-bef5-d6bff52042e4", "name": "vpc"}}`, "5a4981aa-9653-4bd1-bef5-d6bff52042e4"},
+		{"Name when there is no ID", `{"domain": {"name": "example.com", "ttl": 1800}}`, "example.com"},
+		{"Bulk create", `{"droplets": [{"id": 1}, {"id": 2}], "links": {"actions": [{"id": 3}]}}`, "1,2"},
+		{"Not JSON", `<html></html>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, createdResourceID([]byte(tt.body)))
+		})
+	}
+}
+
+func TestReadAuditLogE_InvalidLine(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "godo.jsonl")
+	require.NoError(t, os.WriteFile(auditLog, []byte(`{"method":"POST"}`+"\n\nnot json\n"), 0644))
+
+	_, err := ReadAuditLogE(auditLog)
+	assert.ErrorContains(t, err, "unable to parse audit log "+auditLog+" line 3")
+}
@@ -0,0 +1,461 @@
+package helper
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+	"math/rand/v2"
+	"net/netip"
+	"sort"
+)
+
+// uint128 is an IPv4 or IPv6 address (or address count) as a 128-bit unsigned integer.
+type uint128 struct {
+	hi, lo uint64
+}
+
+// uint128FromAddr converts an address to an integer: IPv4 addresses use the low 32 bits.
+func uint128FromAddr(addr netip.Addr) uint128 {
+	if addr.Is4() {
+		b := addr.As4()
+		return uint128{lo: uint64(binary.BigEndian.Uint32(b[:]))}
+	}
+	b := addr.As16()
+	return uint128{hi: binary.BigEndian.Uint64(b[:8]), lo: binary.BigEndian.Uint64(b[8:])}
+}
+
+// addrFromUint128 converts an integer to an IPv4 (addrBits 32) or IPv6 (addrBits 128) address.
+func addrFromUint128(n uint128, addrBits int) netip.Addr {
+	if addrBits == 32 {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n.lo))
+		return netip.AddrFrom4(b)
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], n.hi)
+	binary.BigEndian.PutUint64(b[8:], n.lo)
+	return netip.AddrFrom16(b)
+}
+
+// pow2 returns 2^n for n < 128.
+func pow2(n int) uint128 {
+	if n >= 64 {
+		return uint128{hi: 1 << (n - 64)}
+	}
+	return uint128{lo: 1 << n}
+}
+
+func (u uint128) add(v uint128) uint128 {
+	lo, carry := bits.Add64(u.lo, v.lo, 0)
+	hi, _ := bits.Add64(u.hi, v.hi, carry)
+	return uint128{hi: hi, lo: lo}
+}
+
+func (u uint128) sub(v uint128) uint128 {
+	lo, borrow := bits.Sub64(u.lo, v.lo, 0)
+	hi, _ := bits.Sub64(u.hi, v.hi, borrow)
+	return uint128{hi: hi, lo: lo}
+}
+
+func (u uint128) addOne() uint128 {
+	return u.add(uint128{lo: 1})
+}
+
+func (u uint128) subOne() uint128 {
+	return u.sub(uint128{lo: 1})
+}
+
+// cmp returns -1, 0 or +1 depending on whether u is less than, equal to or greater than v.
+func (u uint128) cmp(v uint128) int {
+	switch {
+	case u.hi < v.hi || (u.hi == v.hi && u.lo < v.lo):
+		return -1
+	case u == v:
+		return 0
+	}
+	return 1
+}
+
+// alignUp rounds u up to the next multiple of 2^hostBits.
+func (u uint128) alignUp(hostBits int) uint128 {
+	mask := pow2(hostBits).subOne()
+	n := u.add(mask)
+	return uint128{hi: n.hi &^ mask.hi, lo: n.lo &^ mask.lo}
+}
+
+// big converts u to a big.Int.
+func (u uint128) big() *big.Int {
+	n := new(big.Int).SetUint64(u.hi)
+	n.Lsh(n, 64)
+	return n.Or(n, new(big.Int).SetUint64(u.lo))
+}
+
+// float converts u to a float64, rounding if it needs more than 53 bits.
+func (u uint128) float() float64 {
+	return float64(u.hi)*(1<<64) + float64(u.lo)
+}
+
+// addressRange is an inclusive range of addresses [first, last] within one address family.
+type addressRange struct {
+	first, last uint128
+}
+
+// prefixRange returns the range of addresses covered by prefix, which must be masked.
+func prefixRange(prefix netip.Prefix) addressRange {
+	first := uint128FromAddr(prefix.Addr())
+	return addressRange{first: first, last: first.add(pow2(prefix.Addr().BitLen() - prefix.Bits())).subOne()}
+}
+
+// largestAlignedBlock returns the host bits of the largest aligned block that fits inside r, at most maxHostBits.
+func largestAlignedBlock(r addressRange, maxHostBits int) int {
+	fits := func(hostBits int) bool {
+		start := r.first.alignUp(hostBits)
+		if start.cmp(r.first) < 0 {
+			return false // Wrapped around the top of the address space
+		}
+		return start.add(pow2(hostBits)).subOne().cmp(r.last) <= 0
+	}
+	// A block of 2^(k+1) that fits contains one of 2^k that fits, so binary search on k
+	lo, hi := 0, maxHostBits
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// cidrIndex is the set of networks in use within a pool, kept as a treap of the free gaps between them ordered by
+// address. Each node also records the largest aligned block, the number of gaps and the free addresses in its
+// subtree, so overlap lookups, first-fit searches and inserts take O(log n) expected time.
+type cidrIndex struct {
+	pool *cidrPool
+	root *gapNode
+}
+
+// gapNode is a free gap in a cidrIndex.
+type gapNode struct {
+	gap         addressRange
+	block       int    // Largest aligned block (in host bits) gap can hold
+	priority    uint64 // Random heap priority that keeps the treap balanced
+	left, right *gapNode
+
+	// Summaries of the subtree rooted at this node
+	best  int     // Largest aligned block (in host bits); -1 for an empty subtree
+	count int     // Number of gaps
+	free  uint128 // Number of free addresses
+}
+
+// newCidrIndex indexes the networks in used that fall inside pool; networks of the other address family are ignored.
+func newCidrIndex(pool *cidrPool, used []netip.Prefix) *cidrIndex {
+	x := &cidrIndex{pool: pool}
+	ranges := make([]addressRange, 0, len(used))
+	for _, prefix := range used {
+		if r, ok := x.clip(prefix); ok {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].first.cmp(ranges[j].first) < 0
+	})
+
+	// Walk the merged used ranges, collecting the gaps between them
+	var gaps []addressRange
+	cursor, full := pool.first, false
+	for _, r := range mergeRanges(ranges) {
+		if r.first.cmp(cursor) > 0 {
+			gaps = append(gaps, addressRange{first: cursor, last: r.first.subOne()})
+		}
+		if r.last.cmp(pool.last) >= 0 {
+			full = true // Used up to the end of the pool
+			break
+		}
+		cursor = r.last.addOne()
+	}
+	if !full {
+		gaps = append(gaps, addressRange{first: cursor, last: pool.last})
+	}
+	x.root = x.build(gaps)
+	return x
+}
+
+// clip returns the part of prefix inside the pool, or false if there is none.
+func (x *cidrIndex) clip(prefix netip.Prefix) (addressRange, bool) {
+	if prefix.Addr().BitLen() != x.pool.bits {
+		return addressRange{}, false // Different address family
+	}
+	r := prefixRange(prefix)
+	if r.last.cmp(x.pool.first) < 0 || r.first.cmp(x.pool.last) > 0 {
+		return addressRange{}, false // Outside the pool
+	}
+	if r.first.cmp(x.pool.first) < 0 {
+		r.first = x.pool.first
+	}
+	if r.last.cmp(x.pool.last) > 0 {
+		r.last = x.pool.last
+	}
+	return r, true
+}
+
+// mergeRanges merges overlapping and adjacent ranges in a slice sorted by first address.
+func mergeRanges(ranges []addressRange) []addressRange {
+	merged := make([]addressRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.first.cmp(merged[n-1].last.addOne()) <= 0 {
+			if r.last.cmp(merged[n-1].last) > 0 {
+				merged[n-1].last = r.last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// newGapNode returns a leaf for gap.
+func (x *cidrIndex) newGapNode(gap addressRange) *gapNode {
+	n := &gapNode{gap: gap, priority: rand.Uint64()}
+	n.block = largestAlignedBlock(gap, x.pool.bits-x.pool.prefix.Bits())
+	n.update()
+	return n
+}
+
+// build returns a treap of gaps, which must be sorted and disjoint, in O(n).
+func (x *cidrIndex) build(gaps []addressRange) *gapNode {
+	// Keep the right spine on a stack: each new node goes at its bottom, adopting the lower-priority nodes it
+	// displaces as its left subtree
+	var spine []*gapNode
+	for _, gap := range gaps {
+		n := x.newGapNode(gap)
+		var displaced *gapNode
+		for len(spine) > 0 && spine[len(spine)-1].priority < n.priority {
+			displaced = spine[len(spine)-1]
+			spine = spine[:len(spine)-1]
+		}
+		n.left = displaced
+		if len(spine) > 0 {
+			spine[len(spine)-1].right = n
+		}
+		spine = append(spine, n)
+	}
+	if len(spine) == 0 {
+		return nil
+	}
+	spine[0].updateAll()
+	return spine[0]
+}
+
+// updateAll recomputes the summaries of every node in the subtree, bottom up.
+func (n *gapNode) updateAll() {
+	if n == nil {
+		return
+	}
+	n.left.updateAll()
+	n.right.updateAll()
+	n.update()
+}
+
+// update recomputes the summaries of n from its children.
+func (n *gapNode) update() {
+	n.best, n.count, n.free = n.block, 1, n.gap.last.sub(n.gap.first).addOne()
+	for _, child := range []*gapNode{n.left, n.right} {
+		if child != nil {
+			n.best = max(n.best, child.best)
+			n.count += child.count
+			n.free = n.free.add(child.free)
+		}
+	}
+}
+
+// splitGaps splits the treap into the gaps for which before returns true and the rest. before must be true
+// for a prefix of the gaps in address order and false after it.
+func splitGaps(n *gapNode, before func(addressRange) bool) (*gapNode, *gapNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if before(n.gap) {
+		left, right := splitGaps(n.right, before)
+		n.right = left
+		n.update()
+		return n, right
+	}
+	left, right := splitGaps(n.left, before)
+	n.left = right
+	n.update()
+	return left, n
+}
+
+// mergeGaps joins two treaps, where every gap in a comes before every gap in b.
+func mergeGaps(a, b *gapNode) *gapNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = mergeGaps(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = mergeGaps(a, b.left)
+	b.update()
+	return b
+}
+
+// insert marks prefix as used, shrinking or removing the gaps it overlaps in place.
+func (x *cidrIndex) insert(prefix netip.Prefix) {
+	r, ok := x.clip(prefix)
+	if !ok {
+		return
+	}
+	before, rest := splitGaps(x.root, func(gap addressRange) bool { return gap.last.cmp(r.first) < 0 })
+	overlapping, after := splitGaps(rest, func(gap addressRange) bool { return gap.first.cmp(r.last) <= 0 })
+	if overlapping != nil {
+		// Keep the parts of the first and last overlapping gaps outside r; the gaps in between are used up
+		first, last := overlapping, overlapping
+		for first.left != nil {
+			first = first.left
+		}
+		for last.right != nil {
+			last = last.right
+		}
+		if first.gap.first.cmp(r.first) < 0 {
+			before = mergeGaps(before, x.newGapNode(addressRange{first: first.gap.first, last: r.first.subOne()}))
+		}
+		if last.gap.last.cmp(r.last) > 0 {
+			after = mergeGaps(x.newGapNode(addressRange{first: r.last.addOne(), last: last.gap.last}), after)
+		}
+	}
+	x.root = mergeGaps(before, after)
+}
+
+// overlaps reports whether prefix overlaps any used network.
+func (x *cidrIndex) overlaps(prefix netip.Prefix) bool {
+	r, ok := x.clip(prefix)
+	if !ok {
+		return false
+	}
+	// prefix is free only if one gap covers it: the last gap starting at or before it
+	var floor *gapNode
+	for n := x.root; n != nil; {
+		if n.gap.first.cmp(r.first) <= 0 {
+			floor, n = n, n.right
+		} else {
+			n = n.left
+		}
+	}
+	return floor == nil || floor.gap.last.cmp(r.last) < 0
+}
+
+// firstFit returns the lowest aligned free block of 2^hostBits addresses that starts at or after from.
+func (x *cidrIndex) firstFit(hostBits int, from uint128) (uint128, bool) {
+	// The first gap ending at or after from
+	var first *gapNode
+	for n := x.root; n != nil; {
+		if n.gap.last.cmp(from) >= 0 {
+			first, n = n, n.left
+		} else {
+			n = n.right
+		}
+	}
+	if first == nil {
+		return uint128{}, false
+	}
+
+	// It may start before from, so check the part after from directly
+	gap := first.gap
+	if gap.first.cmp(from) < 0 {
+		gap.first = from
+	}
+	if start := gap.first.alignUp(hostBits); start.cmp(gap.first) >= 0 && start.add(pow2(hostBits)).subOne().cmp(gap.last) <= 0 {
+		return start, true
+	}
+
+	next := firstGapHolding(x.root, hostBits, first.gap.first)
+	if next == nil {
+		return uint128{}, false
+	}
+	return next.gap.first.alignUp(hostBits), true
+}
+
+// firstGapHolding returns the first gap starting after after that holds an aligned block of 2^hostBits
+// addresses, or nil if there is none. Subtrees without a large enough block are skipped whole.
+func firstGapHolding(n *gapNode, hostBits int, after uint128) *gapNode {
+	if n == nil || n.best < hostBits {
+		return nil
+	}
+	if n.gap.first.cmp(after) <= 0 {
+		return firstGapHolding(n.right, hostBits, after)
+	}
+	if found := firstGapHolding(n.left, hostBits, after); found != nil {
+		return found
+	}
+	if n.block >= hostBits {
+		return n
+	}
+	return firstGapHolding(n.right, hostBits, after)
+}
+
+// largestFreeBlock returns the host bits of the largest aligned free block, or -1 if the pool is full.
+func (x *cidrIndex) largestFreeBlock() int {
+	if x.root == nil {
+		return -1
+	}
+	return x.root.best
+}
+
+// freeFragments returns the number of separate free gaps.
+func (x *cidrIndex) freeFragments() int {
+	if x.root == nil {
+		return 0
+	}
+	return x.root.count
+}
+
+// freeAddresses returns the number of addresses not in use.
+func (x *cidrIndex) freeAddresses() uint128 {
+	if x.root == nil {
+		return uint128{}
+	}
+	return x.root.free
+}
+
+// freeRanges returns the free gaps in address order.
+func (x *cidrIndex) freeRanges() []addressRange {
+	gaps := make([]addressRange, 0, x.freeFragments())
+	var walk func(n *gapNode)
+	walk = func(n *gapNode) {
+		if n == nil {
+			return
+		}
+		walk(n.left)
+		gaps = append(gaps, n.gap)
+		walk(n.right)
+	}
+	walk(x.root)
+	return gaps
+}
+
+// usedRanges returns the merged ranges in use in address order: everything in the pool between the free gaps.
+func (x *cidrIndex) usedRanges() []addressRange {
+	var used []addressRange
+	cursor, full := x.pool.first, false
+	for _, gap := range x.freeRanges() {
+		if gap.first.cmp(cursor) > 0 {
+			used = append(used, addressRange{first: cursor, last: gap.first.subOne()})
+		}
+		if gap.last.cmp(x.pool.last) >= 0 {
+			full = true // Free up to the end of the pool
+			break
+		}
+		cursor = gap.last.addOne()
+	}
+	if !full {
+		used = append(used, addressRange{first: cursor, last: x.pool.last})
+	}
+	return used
+}
@@ -0,0 +1,287 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice/doservicefakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUint128(t *testing.T) {
+	maxLo := uint128{lo: ^uint64(0)}
+	assert.Equal(t, uint128{hi: 1}, maxLo.addOne(), "add should carry into the high word")
+	assert.Equal(t, maxLo, uint128{hi: 1}.subOne(), "sub should borrow from the high word")
+	assert.Equal(t, uint128{hi: 1 << 63}, pow2(127))
+	assert.Equal(t, uint128{lo: 256}, uint128{lo: 1}.alignUp(8))
+	assert.Equal(t, uint128{lo: 256}, uint128{lo: 256}.alignUp(8))
+	assert.Equal(t, uint128{hi: 1}, uint128{lo: 5}.alignUp(64))
+	assert.Equal(t, -1, uint128{lo: ^uint64(0)}.cmp(uint128{hi: 1}))
+
+	expected, _ := new(big.Int).SetString("18446744073709551617", 10)
+	assert.Equal(t, expected, uint128{hi: 1, lo: 1}.big())
+}
+
+func TestAddrUint128RoundTrip(t *testing.T) {
+	for _, addr := range []string{"10.0.0.0", "192.168.255.255", "fd00::", "fdff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"} {
+		a := netip.MustParseAddr(addr)
+		assert.Equal(t, a, addrFromUint128(uint128FromAddr(a), a.BitLen()), addr)
+	}
+}
+
+func TestCidrIndex_IPv6(t *testing.T) {
+	pool := newCidrPool(netip.MustParsePrefix("fd00::/48"))
+	index := newCidrIndex(pool, []netip.Prefix{
+		netip.MustParsePrefix("fd00::/64"),
+		netip.MustParsePrefix("fd00:0:0:2::/63"),
+		netip.MustParsePrefix("10.0.0.0/8"), // Other address family
+	})
+
+	assert.True(t, index.overlaps(netip.MustParsePrefix("fd00::/56")))
+	assert.True(t, index.overlaps(netip.MustParsePrefix("fd00:0:0:3::/64")))
+	assert.False(t, index.overlaps(netip.MustParsePrefix("fd00:0:0:1::/64")))
+	assert.False(t, index.overlaps(netip.MustParsePrefix("10.0.0.0/24")))
+
+	block, err := pool.findFreeBlock(64, netip.Addr{}, index)
+	require.NoError(t, err)
+	assert.Equal(t, "fd00:0:0:1::/64", block.String())
+
+	block, err = pool.findFreeBlock(62, netip.Addr{}, index)
+	require.NoError(t, err)
+	assert.Equal(t, "fd00:0:0:4::/62", block.String())
+}
+
+func TestCidrIndex_Insert(t *testing.T) {
+	pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/22"))
+	index := newCidrIndex(pool, nil)
+	for _, cidr := range []string{"10.0.1.0/24", "10.0.0.0/24", "10.0.3.0/24", "10.0.2.0/24"} {
+		require.False(t, index.overlaps(netip.MustParsePrefix(cidr)))
+		index.insert(netip.MustParsePrefix(cidr))
+	}
+	assert.Equal(t, []addressRange{prefixRange(pool.prefix)}, index.usedRanges(), "adjacent ranges should be merged")
+	assert.Empty(t, index.freeRanges())
+	assert.Equal(t, 0, index.freeFragments())
+	assert.Equal(t, uint128{}, index.freeAddresses())
+	assert.Equal(t, -1, index.largestFreeBlock())
+
+	_, err := pool.findFreeBlock(28, netip.Addr{}, index)
+	var exhausted *CidrPoolExhaustedError
+	require.ErrorAs(t, err, &exhausted)
+	assert.Equal(t, 0, exhausted.FreeFragments)
+}
+
+// TestCidrIndex_MatchesBruteForce cross-checks overlap lookups and first-fit searches against a linear scan
+func TestCidrIndex_MatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/16"))
+
+	randomPrefix := func(minBits, maxBits int) netip.Prefix {
+		bits := minBits + rng.Intn(maxBits-minBits+1)
+		addr := addrFromUint128(pool.first.add(uint128{lo: uint64(rng.Intn(1 << 16))}), 32)
+		return netip.PrefixFrom(addr, bits).Masked()
+	}
+
+	for round := 0; round < 50; round++ {
+		used := make([]netip.Prefix, 0, 100)
+		for i := 0; i < 100; i++ {
+			used = append(used, randomPrefix(20, 28))
+		}
+		index := newCidrIndex(pool, used)
+
+		// Half the rounds also insert networks into the built index, which must then match one built from scratch
+		if round%2 == 1 {
+			for i := 0; i < 50; i++ {
+				prefix := randomPrefix(18, 30)
+				used = append(used, prefix)
+				index.insert(prefix)
+			}
+			rebuilt := newCidrIndex(pool, used)
+			require.Equal(t, rebuilt.freeRanges(), index.freeRanges())
+			require.Equal(t, rebuilt.freeAddresses(), index.freeAddresses())
+			require.Equal(t, rebuilt.largestFreeBlock(), index.largestFreeBlock())
+		}
+
+		bruteOverlaps := func(candidate netip.Prefix) bool {
+			for _, u := range used {
+				if u.Overlaps(candidate) {
+					return true
+				}
+			}
+			return false
+		}
+
+		for i := 0; i < 200; i++ {
+			candidate := randomPrefix(18, 30)
+			require.Equal(t, bruteOverlaps(candidate), index.overlaps(candidate), "overlaps(%s)", candidate)
+		}
+
+		for i := 0; i < 20; i++ {
+			prefixLength := 20 + rng.Intn(9)
+			hostBits := 32 - prefixLength
+			from := pool.first.add(uint128{lo: uint64(rng.Intn(1 << 16))})
+
+			var expected netip.Prefix
+			for block := from.alignUp(hostBits); block.cmp(pool.last) <= 0; block = block.add(pow2(hostBits)) {
+				candidate := netip.PrefixFrom(addrFromUint128(block, 32), prefixLength)
+				if !bruteOverlaps(candidate) {
+					expected = candidate
+					break
+				}
+			}
+
+			found, ok := index.firstFit(hostBits, from)
+			require.Equal(t, expected.IsValid(), ok, "firstFit(/%d, %s)", prefixLength, addrFromUint128(from, 32))
+			if ok {
+				require.Equal(t, expected, netip.PrefixFrom(addrFromUint128(found, 32), prefixLength))
+			}
+		}
+	}
+}
+
+func TestCidrAssigner_CachesIndex(t *testing.T) {
+	vpcLister := &doservicefakes.FakeVpcLister{}
+	vpcLister.ListReturns([]*godo.VPC{{IPRange: "10.0.0.0/24"}}, &godo.Response{Links: &godo.Links{}}, nil)
+	assigner := NewCidrAssigner(context.Background(), nil, NewVpcCidrSource(vpcLister))
+
+	first, err := assigner.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", first)
+	index := assigner.indexes[netip.MustParsePrefix("10.0.0.0/8")]
+	require.NotNil(t, index)
+
+	// Later allocations update the cached index in place instead of rebuilding it
+	second, err := assigner.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.2.0/24", second)
+	assert.Same(t, index, assigner.indexes[netip.MustParsePrefix("10.0.0.0/8")])
+	assigner.Exclude("10.0.3.0/24")
+	third, err := assigner.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.4.0/24", third)
+	assert.Same(t, index, assigner.indexes[netip.MustParsePrefix("10.0.0.0/8")])
+
+	// Released blocks and networks deleted from the account are free again once the index is rebuilt
+	require.NoError(t, assigner.Release(first))
+	cidr, err := assigner.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, first, cidr)
+	vpcLister.ListReturns(nil, &godo.Response{Links: &godo.Links{}}, nil)
+	require.NoError(t, assigner.Refresh())
+	cidr, err = assigner.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/24", cidr)
+	assert.Equal(t, 2, vpcLister.ListCallCount())
+}
+
+// benchmarkNetworks returns n non-overlapping /26 networks spread across 10.0.0.0/8 with a gap after each one
+func benchmarkNetworks(n int) []netip.Prefix {
+	networks := make([]netip.Prefix, 0, n)
+	first := uint128FromAddr(netip.MustParseAddr("10.0.0.0"))
+	for i := 0; i < n; i++ {
+		addr := addrFromUint128(first.add(uint128{lo: uint64(i) * 128}), 32)
+		networks = append(networks, netip.PrefixFrom(addr, 26))
+	}
+	return networks
+}
+
+var benchmarkSizes = []int{10_000, 50_000}
+
+func BenchmarkNewCidrIndex(b *testing.B) {
+	pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/8"))
+	for _, n := range benchmarkSizes {
+		networks := benchmarkNetworks(n)
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				newCidrIndex(pool, networks)
+			}
+		})
+	}
+}
+
+func BenchmarkCidrIndex_Overlaps(b *testing.B) {
+	pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/8"))
+	for _, n := range benchmarkSizes {
+		index := newCidrIndex(pool, benchmarkNetworks(n))
+		candidate := netip.MustParsePrefix("10.0.64.0/24")
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				index.overlaps(candidate)
+			}
+		})
+	}
+}
+
+func BenchmarkCidrPool_FindFreeBlock(b *testing.B) {
+	pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/8"))
+	for _, n := range benchmarkSizes {
+		index := newCidrIndex(pool, benchmarkNetworks(n))
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := pool.findFreeBlock(24, netip.Addr{}, index); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCidrIndex_Insert(b *testing.B) {
+	pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/8"))
+	first := uint128FromAddr(netip.MustParseAddr("10.128.0.0"))
+	for _, n := range benchmarkSizes {
+		index := newCidrIndex(pool, benchmarkNetworks(n))
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Successive /30s in 10.128.0.0/9, wrapping around to ones already inserted
+				addr := addrFromUint128(first.add(uint128{lo: uint64(i%(1<<21)) * 4}), 32)
+				index.insert(netip.PrefixFrom(addr, 30))
+			}
+		})
+	}
+}
+
+// BenchmarkCidrAssigner_GetVpcCidr measures allocations from an assigner whose index is already built, which is
+// the cost every allocation after the first in a test run pays.
+func BenchmarkCidrAssigner_GetVpcCidr(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		// Half the networks are VPCs and half are DOKS cluster subnets
+		networks := benchmarkNetworks(n)
+		vpcs := make([]*godo.VPC, 0, n/2)
+		clusters := make([]*godo.KubernetesCluster, 0, n/2)
+		for i := 0; i < n/2; i++ {
+			vpcs = append(vpcs, &godo.VPC{IPRange: networks[2*i].String()})
+			clusters = append(clusters, &godo.KubernetesCluster{ClusterSubnet: networks[2*i+1].String()})
+		}
+		sources := fakeCidrSources(vpcs, clusters)
+		newAssigner := func() *CidrAssigner {
+			assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{Sources: sources, InventoryTTL: time.Hour})
+			if _, err := assigner.GetVpcCidrE(); err != nil {
+				b.Fatal(err)
+			}
+			return assigner
+		}
+
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			assigner := newAssigner()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Start again well before the pool runs out of /24s
+				if i > 0 && i%10_000 == 0 {
+					b.StopTimer()
+					assigner = newAssigner()
+					b.StartTimer()
+				}
+				if _, err := assigner.GetVpcCidrE(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
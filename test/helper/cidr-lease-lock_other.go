@@ -0,0 +1,19 @@
+//go:build !unix && !windows
+
+package helper
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFileExclusive fails on platforms without file locking; use a RemoteCidrLeaseStore there instead.
+func lockFileExclusive(*os.File) error {
+	return fmt.Errorf("file locks are not supported on %s", runtime.GOOS)
+}
+
+// unlockFile is a no-op on platforms without file locking.
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package helper
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFileExclusive blocks until it holds an exclusive advisory lock on f.
+func lockFileExclusive(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile releases a lock taken with lockFileExclusive.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,537 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+)
+
+// DefaultCidrLeaseTTL is how long a lease is held when no TTL is specified.
+// It comfortably covers the longest reference architecture apply/destroy cycle.
+const DefaultCidrLeaseTTL = 2 * time.Hour
+
+// maxLeaseStoreAttempts bounds the optimistic-concurrency retries of RemoteCidrLeaseStore.
+const maxLeaseStoreAttempts = 10
+
+var (
+	// ErrLeaseConflict is returned when a CIDR block overlaps an active lease held by another owner.
+	ErrLeaseConflict = errors.New("CIDR block overlaps an active lease held by another owner")
+
+	// ErrLeaseNotFound is returned when renewing or releasing a lease the owner does not hold.
+	ErrLeaseNotFound = errors.New("no active lease held for CIDR block")
+
+	// ErrLeaseRevisionMismatch is returned by a CidrLeaseBackend when the ledger changed since it was loaded.
+	ErrLeaseRevisionMismatch = errors.New("lease ledger was modified concurrently")
+)
+
+// CidrLease records a CIDR block reserved by a test run.
+type CidrLease struct {
+	Cidr      string    `json:"cidr"`
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CidrLeaseStore is a ledger of CIDR leases shared between processes, so parallel CI jobs
+// never hand out the same block before either of them has applied.
+type CidrLeaseStore interface {
+	// Acquire leases cidr to owner for ttl. It returns ErrLeaseConflict if the block overlaps
+	// an active lease held by a different owner. Acquiring a block the owner already holds extends it.
+	Acquire(ctx context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error)
+
+	// Renew extends an active lease held by owner to expire ttl from now.
+	Renew(ctx context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error)
+
+	// Release removes the lease held by owner on cidr.
+	Release(ctx context.Context, cidr, owner string) error
+
+	// List returns all active (unexpired) leases.
+	List(ctx context.Context) ([]CidrLease, error)
+}
+
+// DefaultCidrLeaseOwner returns a lease owner that is unique to this process and call,
+// prefixed with the GitHub Actions run ID when running in CI.
+func DefaultCidrLeaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	owner := fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), random.UniqueId())
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		owner = fmt.Sprintf("gha-%s-%s", runID, owner)
+	}
+	return owner
+}
+
+// CidrLeaseStoreFromEnv returns the lease store configured by the environment, so jobs on different runners
+// share one ledger without code changes: an HTTPCidrLeaseBackend at $CIDR_LEASE_URL, sending $CIDR_LEASE_TOKEN
+// as a bearer token if set, or else a FileCidrLeaseStore at $CIDR_LEASE_FILE. It returns nil if neither is set.
+func CidrLeaseStoreFromEnv() CidrLeaseStore {
+	if url := os.Getenv("CIDR_LEASE_URL"); url != "" {
+		header := http.Header{}
+		if token := os.Getenv("CIDR_LEASE_TOKEN"); token != "" {
+			header.Set("Authorization", "Bearer "+token)
+		}
+		return NewRemoteCidrLeaseStore(NewHTTPCidrLeaseBackend(url, nil, header))
+	}
+	if path := os.Getenv("CIDR_LEASE_FILE"); path != "" {
+		return NewFileCidrLeaseStore(path)
+	}
+	return nil
+}
+
+// leaseLedger is the serialized form of the lease ledger shared by all backends.
+type leaseLedger struct {
+	Leases []CidrLease `json:"leases"`
+}
+
+// activeLeases returns the leases that have not expired at now.
+func (l *leaseLedger) activeLeases(now time.Time) []CidrLease {
+	active := make([]CidrLease, 0, len(l.Leases))
+	for _, lease := range l.Leases {
+		if now.Before(lease.ExpiresAt) {
+			active = append(active, lease)
+		}
+	}
+	return active
+}
+
+// acquire adds or extends a lease, dropping expired leases along the way.
+func (l *leaseLedger) acquire(cidr, owner string, ttl time.Duration, now time.Time) (*CidrLease, error) {
+	candidate, err := parsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %s: %w", cidr, err)
+	}
+
+	active := l.activeLeases(now)
+	for i, lease := range active {
+		if lease.Cidr == cidr && lease.Owner == owner {
+			active[i].ExpiresAt = now.Add(ttl)
+			l.Leases = active
+			return &active[i], nil
+		}
+		existing, err := parsePrefix(lease.Cidr)
+		if err != nil {
+			continue // Skip invalid CIDRs
+		}
+		if lease.Owner != owner && networksOverlap(candidate, existing) {
+			return nil, fmt.Errorf("%s overlaps %s leased by %s: %w", cidr, lease.Cidr, lease.Owner, ErrLeaseConflict)
+		}
+	}
+
+	lease := CidrLease{Cidr: cidr, Owner: owner, ExpiresAt: now.Add(ttl)}
+	l.Leases = append(active, lease)
+	return &lease, nil
+}
+
+// renew extends an active lease held by owner.
+func (l *leaseLedger) renew(cidr, owner string, ttl time.Duration, now time.Time) (*CidrLease, error) {
+	l.Leases = l.activeLeases(now)
+	for i, lease := range l.Leases {
+		if lease.Cidr == cidr && lease.Owner == owner {
+			l.Leases[i].ExpiresAt = now.Add(ttl)
+			return &l.Leases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s for owner %s: %w", cidr, owner, ErrLeaseNotFound)
+}
+
+// release removes the lease held by owner.
+func (l *leaseLedger) release(cidr, owner string, now time.Time) error {
+	active := l.activeLeases(now)
+	for i, lease := range active {
+		if lease.Cidr == cidr && lease.Owner == owner {
+			l.Leases = append(active[:i], active[i+1:]...)
+			return nil
+		}
+	}
+	l.Leases = active
+	return fmt.Errorf("%s for owner %s: %w", cidr, owner, ErrLeaseNotFound)
+}
+
+// decodeLeaseLedger parses a serialized ledger, treating empty data as an empty ledger.
+func decodeLeaseLedger(data []byte) (*leaseLedger, error) {
+	ledger := &leaseLedger{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return ledger, nil
+	}
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, fmt.Errorf("failed to decode lease ledger: %w", err)
+	}
+	return ledger, nil
+}
+
+// FileCidrLeaseStore keeps the lease ledger in a JSON file guarded by an advisory file lock.
+// It is intended for local runs where several test processes share one machine.
+type FileCidrLeaseStore struct {
+	path string
+	now  func() time.Time
+}
+
+// NewFileCidrLeaseStore creates a lease store backed by the JSON file at path.
+// The file and a sibling ".lock" file are created on first use.
+func NewFileCidrLeaseStore(path string) *FileCidrLeaseStore {
+	return &FileCidrLeaseStore{path: path, now: time.Now}
+}
+
+// Acquire implements CidrLeaseStore.
+func (s *FileCidrLeaseStore) Acquire(_ context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error) {
+	var lease *CidrLease
+	err := s.update(func(ledger *leaseLedger) error {
+		var err error
+		lease, err = ledger.acquire(cidr, owner, ttl, s.now())
+		return err
+	})
+	return lease, err
+}
+
+// Renew implements CidrLeaseStore.
+func (s *FileCidrLeaseStore) Renew(_ context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error) {
+	var lease *CidrLease
+	err := s.update(func(ledger *leaseLedger) error {
+		var err error
+		lease, err = ledger.renew(cidr, owner, ttl, s.now())
+		return err
+	})
+	return lease, err
+}
+
+// Release implements CidrLeaseStore.
+func (s *FileCidrLeaseStore) Release(_ context.Context, cidr, owner string) error {
+	return s.update(func(ledger *leaseLedger) error {
+		return ledger.release(cidr, owner, s.now())
+	})
+}
+
+// List implements CidrLeaseStore.
+func (s *FileCidrLeaseStore) List(_ context.Context) ([]CidrLease, error) {
+	var leases []CidrLease
+	err := s.withLock(func() error {
+		ledger, err := s.read()
+		if err != nil {
+			return err
+		}
+		leases = ledger.activeLeases(s.now())
+		return nil
+	})
+	return leases, err
+}
+
+// update applies fn to the ledger while holding the file lock and writes the result back.
+func (s *FileCidrLeaseStore) update(fn func(*leaseLedger) error) error {
+	return s.withLock(func() error {
+		ledger, err := s.read()
+		if err != nil {
+			return err
+		}
+		if err := fn(ledger); err != nil {
+			return err
+		}
+		return s.write(ledger)
+	})
+}
+
+// withLock runs fn while holding an exclusive lock on the ledger's lock file.
+func (s *FileCidrLeaseStore) withLock(fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create lease directory: %w", err)
+	}
+	lockFile, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lease lock file: %w", err)
+	}
+	defer lockFile.Close()
+
+	if err := lockFileExclusive(lockFile); err != nil {
+		return fmt.Errorf("failed to lock lease file: %w", err)
+	}
+	defer unlockFile(lockFile)
+
+	return fn()
+}
+
+// read loads the ledger, returning an empty ledger if the file does not exist yet.
+func (s *FileCidrLeaseStore) read() (*leaseLedger, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &leaseLedger{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease file: %w", err)
+	}
+	return decodeLeaseLedger(data)
+}
+
+// write replaces the ledger file atomically via a temp file and rename.
+func (s *FileCidrLeaseStore) write(ledger *leaseLedger) error {
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lease ledger: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp lease file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp lease file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp lease file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace lease file: %w", err)
+	}
+	return nil
+}
+
+// CidrLeaseBackend stores the serialized lease ledger for a RemoteCidrLeaseStore.
+// Implementations must provide compare-and-swap semantics so concurrent writers never lose updates.
+type CidrLeaseBackend interface {
+	// Load returns the ledger contents and an opaque revision. A ledger that does not exist yet
+	// is returned as nil data with an empty revision.
+	Load(ctx context.Context) (data []byte, revision string, err error)
+
+	// Store writes data only if the ledger is still at revision (empty meaning "does not exist").
+	// It returns ErrLeaseRevisionMismatch if another writer got there first.
+	Store(ctx context.Context, data []byte, revision string) error
+}
+
+// RemoteCidrLeaseStore keeps the lease ledger in a remote CidrLeaseBackend, retrying
+// optimistic updates that lose a race with another writer.
+type RemoteCidrLeaseStore struct {
+	backend CidrLeaseBackend
+	now     func() time.Time
+}
+
+// NewRemoteCidrLeaseStore creates a lease store on top of the given backend.
+func NewRemoteCidrLeaseStore(backend CidrLeaseBackend) *RemoteCidrLeaseStore {
+	return &RemoteCidrLeaseStore{backend: backend, now: time.Now}
+}
+
+// Acquire implements CidrLeaseStore.
+func (s *RemoteCidrLeaseStore) Acquire(ctx context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error) {
+	var lease *CidrLease
+	err := s.update(ctx, func(ledger *leaseLedger) error {
+		var err error
+		lease, err = ledger.acquire(cidr, owner, ttl, s.now())
+		return err
+	})
+	return lease, err
+}
+
+// Renew implements CidrLeaseStore.
+func (s *RemoteCidrLeaseStore) Renew(ctx context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error) {
+	var lease *CidrLease
+	err := s.update(ctx, func(ledger *leaseLedger) error {
+		var err error
+		lease, err = ledger.renew(cidr, owner, ttl, s.now())
+		return err
+	})
+	return lease, err
+}
+
+// Release implements CidrLeaseStore.
+func (s *RemoteCidrLeaseStore) Release(ctx context.Context, cidr, owner string) error {
+	return s.update(ctx, func(ledger *leaseLedger) error {
+		return ledger.release(cidr, owner, s.now())
+	})
+}
+
+// List implements CidrLeaseStore.
+func (s *RemoteCidrLeaseStore) List(ctx context.Context) ([]CidrLease, error) {
+	data, _, err := s.backend.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lease ledger: %w", err)
+	}
+	ledger, err := decodeLeaseLedger(data)
+	if err != nil {
+		return nil, err
+	}
+	return ledger.activeLeases(s.now()), nil
+}
+
+// update performs a load-modify-store cycle, retrying when the backend reports a concurrent write.
+func (s *RemoteCidrLeaseStore) update(ctx context.Context, fn func(*leaseLedger) error) error {
+	for attempt := 1; attempt <= maxLeaseStoreAttempts; attempt++ {
+		data, revision, err := s.backend.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load lease ledger: %w", err)
+		}
+		ledger, err := decodeLeaseLedger(data)
+		if err != nil {
+			return err
+		}
+		if err := fn(ledger); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(ledger)
+		if err != nil {
+			return fmt.Errorf("failed to encode lease ledger: %w", err)
+		}
+		err = s.backend.Store(ctx, encoded, revision)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrLeaseRevisionMismatch) {
+			return fmt.Errorf("failed to store lease ledger: %w", err)
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", maxLeaseStoreAttempts, ErrLeaseRevisionMismatch)
+}
+
+// HTTPCidrLeaseBackend is a CidrLeaseBackend that keeps the ledger as a single document at a URL,
+// using ETags with If-Match / If-None-Match conditional PUTs for compare-and-swap.
+type HTTPCidrLeaseBackend struct {
+	url    string
+	client *http.Client
+	header http.Header
+}
+
+// NewHTTPCidrLeaseBackend creates a backend for the ledger document at url. If client is nil,
+// http.DefaultClient is used. header is added to every request (e.g. an Authorization header).
+func NewHTTPCidrLeaseBackend(url string, client *http.Client, header http.Header) *HTTPCidrLeaseBackend {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPCidrLeaseBackend{url: url, client: client, header: header}
+}
+
+// Load implements CidrLeaseBackend.
+func (b *HTTPCidrLeaseBackend) Load(ctx context.Context) ([]byte, string, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status loading lease ledger: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// Store implements CidrLeaseBackend.
+func (b *HTTPCidrLeaseBackend) Store(ctx context.Context, data []byte, revision string) error {
+	req, err := b.newRequest(ctx, http.MethodPut, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if revision == "" {
+		req.Header.Set("If-None-Match", "*")
+	} else {
+		req.Header.Set("If-Match", revision)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return ErrLeaseRevisionMismatch
+	default:
+		return fmt.Errorf("unexpected status storing lease ledger: %s", resp.Status)
+	}
+}
+
+// newRequest builds a request to the ledger URL carrying the configured headers.
+func (b *HTTPCidrLeaseBackend) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range b.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return req, nil
+}
+
+// CidrLeaseServer is an in-memory stand-in for the remote ledger that HTTPCidrLeaseBackend talks to.
+// It serves a single document at every path and honours If-Match / If-None-Match on PUT.
+// Use it with httptest.NewServer in tests, or run it as a lightweight shared service.
+type CidrLeaseServer struct {
+	mu       sync.Mutex
+	data     []byte
+	revision int
+}
+
+// NewCidrLeaseServer creates an empty CidrLeaseServer.
+func NewCidrLeaseServer() *CidrLeaseServer {
+	return &CidrLeaseServer{}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *CidrLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	etag := ""
+	if s.data != nil {
+		etag = strconv.Quote(strconv.Itoa(s.revision))
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if s.data == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(s.data)
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && s.data != nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.data = data
+		s.revision++
+		w.Header().Set("ETag", strconv.Quote(strconv.Itoa(s.revision)))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
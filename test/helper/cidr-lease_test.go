@@ -0,0 +1,179 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// leaseStoresUnderTest returns a fresh instance of every CidrLeaseStore backend
+func leaseStoresUnderTest(t *testing.T) map[string]func() CidrLeaseStore {
+	path := filepath.Join(t.TempDir(), "leases.json")
+	server := httptest.NewServer(NewCidrLeaseServer())
+	t.Cleanup(server.Close)
+
+	return map[string]func() CidrLeaseStore{
+		"file": func() CidrLeaseStore {
+			return NewFileCidrLeaseStore(path)
+		},
+		"remote": func() CidrLeaseStore {
+			return NewRemoteCidrLeaseStore(NewHTTPCidrLeaseBackend(server.URL+"/leases.json", server.Client(), nil))
+		},
+	}
+}
+
+func TestCidrLeaseStore_Lifecycle(t *testing.T) {
+	for name, newStore := range leaseStoresUnderTest(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore()
+
+			_, err := store.Acquire(ctx, "10.0.0.0/24", "owner-a", time.Hour)
+			require.NoError(t, err)
+
+			// Overlapping block for a different owner conflicts, even via a second store instance
+			_, err = newStore().Acquire(ctx, "10.0.0.0/16", "owner-b", time.Hour)
+			assert.ErrorIs(t, err, ErrLeaseConflict)
+
+			// Re-acquiring your own block extends it
+			_, err = store.Acquire(ctx, "10.0.0.0/24", "owner-a", 2*time.Hour)
+			require.NoError(t, err)
+
+			lease, err := store.Renew(ctx, "10.0.0.0/24", "owner-a", 3*time.Hour)
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(3*time.Hour), lease.ExpiresAt, time.Minute)
+
+			_, err = store.Renew(ctx, "10.0.0.0/24", "owner-b", time.Hour)
+			assert.ErrorIs(t, err, ErrLeaseNotFound)
+
+			leases, err := store.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, leases, 1)
+
+			require.NoError(t, store.Release(ctx, "10.0.0.0/24", "owner-a"))
+			assert.ErrorIs(t, store.Release(ctx, "10.0.0.0/24", "owner-a"), ErrLeaseNotFound)
+
+			_, err = newStore().Acquire(ctx, "10.0.0.0/16", "owner-b", time.Hour)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCidrLeaseStore_ExpiredLeasesDoNotConflict(t *testing.T) {
+	for name, newStore := range leaseStoresUnderTest(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore()
+
+			_, err := store.Acquire(ctx, "10.1.0.0/24", "owner-a", time.Millisecond)
+			require.NoError(t, err)
+			time.Sleep(5 * time.Millisecond)
+
+			_, err = store.Acquire(ctx, "10.1.0.0/24", "owner-b", time.Hour)
+			require.NoError(t, err)
+
+			leases, err := store.List(ctx)
+			require.NoError(t, err)
+			require.Len(t, leases, 1)
+			assert.Equal(t, "owner-b", leases[0].Owner)
+		})
+	}
+}
+
+func TestCidrLeaseStore_ConcurrentAcquireHasSingleWinner(t *testing.T) {
+	for name, newStore := range leaseStoresUnderTest(t) {
+		t.Run(name, func(t *testing.T) {
+			const contenders = 8
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				winners int
+			)
+			for i := 0; i < contenders; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, err := newStore().Acquire(context.Background(), "10.2.0.0/24", fmt.Sprintf("owner-%d", i), time.Hour)
+					if err == nil {
+						mu.Lock()
+						winners++
+						mu.Unlock()
+						return
+					}
+					assert.ErrorIs(t, err, ErrLeaseConflict)
+				}(i)
+			}
+			wg.Wait()
+			assert.Equal(t, 1, winners)
+		})
+	}
+}
+
+func TestCidrAssigner_GetCidrBlockSkipsLeasedBlocks(t *testing.T) {
+	for name, newStore := range leaseStoresUnderTest(t) {
+		t.Run(name, func(t *testing.T) {
+			sources := fakeCidrSources([]*godo.VPC{{IPRange: "10.0.0.0/24"}}, nil)
+
+			// Two assigners sharing a ledger but not each other's memory, as in two CI jobs
+			first := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{Sources: sources, LeaseStore: newStore()})
+			second := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{Sources: sources, LeaseStore: newStore()})
+
+			cidr, err := first.GetCidrBlock("10.0.0.0", 24)
+			require.NoError(t, err)
+			assert.Equal(t, "10.0.1.0/24", cidr)
+
+			cidr, err = second.GetCidrBlock("10.0.0.0", 24)
+			require.NoError(t, err)
+			assert.Equal(t, "10.0.2.0/24", cidr)
+
+			assert.NoError(t, first.RenewLeases())
+		})
+	}
+}
+
+func TestCidrLeaseStoreFromEnv(t *testing.T) {
+	sources := fakeCidrSources(nil, nil)
+	ledger := NewCidrLeaseServer()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer lease-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ledger.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("CIDR_LEASE_URL", "")
+	t.Setenv("CIDR_LEASE_FILE", "")
+	assert.Nil(t, CidrLeaseStoreFromEnv())
+
+	// Assigners given the store the environment names share it, as in two CI jobs
+	t.Setenv("CIDR_LEASE_URL", server.URL+"/leases.json")
+	t.Setenv("CIDR_LEASE_TOKEN", "lease-token")
+	first := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{Sources: sources, LeaseStore: CidrLeaseStoreFromEnv()})
+	second := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{Sources: sources, LeaseStore: CidrLeaseStoreFromEnv()})
+	assert.Nil(t, NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{Sources: sources}).leaseStore,
+		"assigners that aren't given a store track blocks in memory")
+	cidr, err := first.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/24", cidr)
+	cidr, err = second.GetCidrBlock("10.0.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", cidr)
+
+	t.Setenv("CIDR_LEASE_URL", "")
+	t.Setenv("CIDR_LEASE_FILE", filepath.Join(t.TempDir(), "leases.json"))
+	store := CidrLeaseStoreFromEnv()
+	require.IsType(t, &FileCidrLeaseStore{}, store)
+	_, err = store.Acquire(context.Background(), "10.0.0.0/24", "owner-a", time.Hour)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,164 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+)
+
+// DefaultCidrPool is the pool the typed getters (GetVpcCidr and friends) allocate from.
+const DefaultCidrPool = "10.0.0.0/8"
+
+// privateCidrPools are the pools a bare base network is expanded to, most specific first.
+var privateCidrPools = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fd00::/8",
+	"fc00::/7",
+}
+
+// ErrCidrPoolExhausted is matched (via errors.Is) by errors returned when a pool has no free block of the requested size.
+var ErrCidrPoolExhausted = errors.New("CIDR pool exhausted")
+
+// CidrPoolExhaustedError reports how fragmented a pool was when no block of the requested size could be found.
+type CidrPoolExhaustedError struct {
+	Pool              string   // Pool that was searched (e.g. "10.0.0.0/8")
+	PrefixLength      int      // Requested prefix length
+	FreeAddresses     *big.Int // Total addresses in the pool not covered by existing networks
+	FreeFragments     int      // Number of disjoint free ranges in the pool
+	LargestFreePrefix int      // Prefix length of the largest aligned free block, or 0 if the pool is full
+}
+
+func (e *CidrPoolExhaustedError) Error() string {
+	if e.FreeFragments == 0 {
+		return fmt.Sprintf("no free /%d block in %s: pool is fully allocated", e.PrefixLength, e.Pool)
+	}
+	return fmt.Sprintf("no free /%d block in %s: %s addresses free across %d fragments, largest free block is a /%d",
+		e.PrefixLength, e.Pool, e.FreeAddresses, e.FreeFragments, e.LargestFreePrefix)
+}
+
+// Unwrap lets errors.Is match ErrCidrPoolExhausted.
+func (e *CidrPoolExhaustedError) Unwrap() error {
+	return ErrCidrPoolExhausted
+}
+
+// cidrPool is a private network that blocks are allocated from.
+type cidrPool struct {
+	prefix      netip.Prefix
+	bits        int // 32 for IPv4, 128 for IPv6
+	first, last uint128
+}
+
+// parsePrefix parses a network in CIDR notation, masking any host bits (so "10.0.0.5/24" is "10.0.0.0/24")
+// and converting IPv4-mapped IPv6 networks to IPv4.
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// parseCidrPool parses and validates a pool in CIDR notation. The pool must be entirely private address space.
+func parseCidrPool(pool string) (*cidrPool, error) {
+	prefix, err := parsePrefix(pool)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR pool %s: %w", pool, err)
+	}
+	p := newCidrPool(prefix)
+	if !prefix.Addr().IsPrivate() || !addrFromUint128(p.last, p.bits).IsPrivate() {
+		return nil, fmt.Errorf("CIDR pool %s is not entirely private (RFC1918 or unique local) address space", pool)
+	}
+	return p, nil
+}
+
+// poolForAddress returns the private pool that contains addr.
+func poolForAddress(addr netip.Addr) (*cidrPool, error) {
+	for _, pool := range privateCidrPools {
+		prefix := netip.MustParsePrefix(pool)
+		if prefix.Contains(addr) {
+			return newCidrPool(prefix), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not a private (RFC1918 or unique local) address", addr)
+}
+
+// newCidrPool builds a cidrPool from a masked prefix.
+func newCidrPool(prefix netip.Prefix) *cidrPool {
+	r := prefixRange(prefix)
+	return &cidrPool{prefix: prefix, bits: prefix.Addr().BitLen(), first: r.first, last: r.last}
+}
+
+// validatePrefixLength checks that prefixLength is allowed for the pool's address family and fits inside the pool.
+func (p *cidrPool) validatePrefixLength(prefixLength int) error {
+	if p.bits == 32 {
+		if prefixLength < minIPv4PrefixLength || prefixLength > maxIPv4PrefixLength {
+			return fmt.Errorf("IPv4 prefix length must be between %d and %d, got %d", minIPv4PrefixLength, maxIPv4PrefixLength, prefixLength)
+		}
+	} else if prefixLength < minIPv6PrefixLength || prefixLength > maxIPv6PrefixLength {
+		return fmt.Errorf("IPv6 prefix length must be between %d and %d, got %d", minIPv6PrefixLength, maxIPv6PrefixLength, prefixLength)
+	}
+	if prefixLength < p.prefix.Bits() {
+		return fmt.Errorf("prefix length /%d is larger than the pool %s", prefixLength, p.prefix)
+	}
+	return nil
+}
+
+// contains reports whether other lies entirely inside the pool.
+func (p *cidrPool) contains(other *cidrPool) bool {
+	return p.bits == other.bits && p.first.cmp(other.first) <= 0 && p.last.cmp(other.last) >= 0
+}
+
+// seededStart hashes seed to an address in the pool, so that searches with different seeds start in
+// different places and searches with the same seed start in the same place.
+func (p *cidrPool) seededStart(seed string) netip.Addr {
+	sum := sha256.Sum256([]byte(seed))
+	offset := uint128{hi: binary.BigEndian.Uint64(sum[:8]), lo: binary.BigEndian.Uint64(sum[8:16])}
+	mask := p.last.sub(p.first)
+	return addrFromUint128(p.first.add(uint128{hi: offset.hi & mask.hi, lo: offset.lo & mask.lo}), p.bits)
+}
+
+// findFreeBlock returns the first free block of prefixLength at or after start, wrapping around to the
+// start of the pool, so that every aligned block in the pool is considered exactly once. start may be
+// the zero Addr to search from the start of the pool.
+// If none is free it returns a *CidrPoolExhaustedError describing the pool's fragmentation.
+func (p *cidrPool) findFreeBlock(prefixLength int, start netip.Addr, used *cidrIndex) (netip.Prefix, error) {
+	if err := p.validatePrefixLength(prefixLength); err != nil {
+		return netip.Prefix{}, err
+	}
+	from := p.first
+	if start.IsValid() && p.prefix.Contains(start) {
+		from = uint128FromAddr(start)
+	}
+
+	hostBits := p.bits - prefixLength
+	found, ok := used.firstFit(hostBits, from)
+	if !ok && from != p.first {
+		found, ok = used.firstFit(hostBits, p.first)
+	}
+	if !ok {
+		return netip.Prefix{}, p.exhaustedError(prefixLength, used)
+	}
+	return netip.PrefixFrom(addrFromUint128(found, p.bits), prefixLength), nil
+}
+
+// exhaustedError summarises the free space left in the pool.
+func (p *cidrPool) exhaustedError(prefixLength int, used *cidrIndex) *CidrPoolExhaustedError {
+	err := &CidrPoolExhaustedError{
+		Pool:          p.prefix.String(),
+		PrefixLength:  prefixLength,
+		FreeAddresses: used.freeAddresses().big(),
+		FreeFragments: used.freeFragments(),
+	}
+	if largest := used.largestFreeBlock(); largest >= 0 {
+		err.LargestFreePrefix = p.bits - largest
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package helper
+
+import (
+	"fmt"
+	"log"
+	"testing"
+)
+
+// Prefix lengths used by the reference architectures for each kind of network.
+const (
+	vpcPrefixLength         = 24
+	doksClusterPrefixLength = 19
+	doksServicePrefixLength = 22
+)
+
+// DoksNetworkProfile is the set of networks a DOKS reference architecture deploys into.
+type DoksNetworkProfile struct {
+	VpcCidr     string // /24 for the VPC
+	ClusterCidr string // /19 for the DOKS cluster (pod) network
+	ServiceCidr string // /22 for the DOKS service network
+}
+
+// RegionalVpc is one VPC of a multi-region deployment.
+type RegionalVpc struct {
+	Region  string
+	IPRange string
+}
+
+// MultiRegionVpcProfile is the set of VPCs a multi-region reference architecture deploys into.
+type MultiRegionVpcProfile struct {
+	Vpcs []RegionalVpc
+}
+
+// TerraformValue returns the VPCs in the shape of the multi-region-vpc module's vpcs variable,
+// ready to pass to terraform.VarInline.
+func (p *MultiRegionVpcProfile) TerraformValue() []interface{} {
+	vpcs := make([]interface{}, 0, len(p.Vpcs))
+	for _, vpc := range p.Vpcs {
+		vpcs = append(vpcs, map[string]interface{}{
+			"region":   vpc.Region,
+			"ip_range": vpc.IPRange,
+		})
+	}
+	return vpcs
+}
+
+// GetDoksNetworkProfileE allocates a VPC, DOKS cluster and DOKS service network together, from a single
+// snapshot of the existing networks. Either all three are allocated or none are. The largest block is allocated
+// first, so the smaller ones fill the space after it rather than leaving alignment gaps in front of it.
+func (ca *CidrAssigner) GetDoksNetworkProfileE() (*DoksNetworkProfile, error) {
+	cidrs, err := ca.GetCidrBlocksFromPool(ca.pool, doksClusterPrefixLength, doksServicePrefixLength, vpcPrefixLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DOKS network profile: %w", err)
+	}
+	return &DoksNetworkProfile{
+		VpcCidr:     cidrs[2],
+		ClusterCidr: cidrs[0],
+		ServiceCidr: cidrs[1],
+	}, nil
+}
+
+// GetDoksNetworkProfileT is like GetDoksNetworkProfileE but fails the test if the profile cannot be assigned.
+// The networks are released when the test finishes, unless the test failed.
+func (ca *CidrAssigner) GetDoksNetworkProfileT(t testing.TB) *DoksNetworkProfile {
+	t.Helper()
+	profile, err := ca.GetDoksNetworkProfileE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.releaseOnCleanup(t, profile.VpcCidr, profile.ClusterCidr, profile.ServiceCidr)
+	return profile
+}
+
+// GetDoksNetworkProfile allocates a VPC, DOKS cluster and DOKS service network together.
+// It will fatal the test if the profile cannot be assigned.
+func (ca *CidrAssigner) GetDoksNetworkProfile() *DoksNetworkProfile {
+	profile, err := ca.GetDoksNetworkProfileE()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return profile
+}
+
+// GetMultiRegionVpcProfileE allocates a /24 VPC for each region, from a single snapshot of the existing networks.
+// Either every VPC is allocated or none are.
+func (ca *CidrAssigner) GetMultiRegionVpcProfileE(regions ...string) (*MultiRegionVpcProfile, error) {
+	prefixLengths := make([]int, len(regions))
+	for i := range prefixLengths {
+		prefixLengths[i] = vpcPrefixLength
+	}
+	cidrs, err := ca.GetCidrBlocksFromPool(ca.pool, prefixLengths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get multi-region VPC profile: %w", err)
+	}
+
+	profile := &MultiRegionVpcProfile{}
+	for i, region := range regions {
+		profile.Vpcs = append(profile.Vpcs, RegionalVpc{Region: region, IPRange: cidrs[i]})
+	}
+	return profile, nil
+}
+
+// GetMultiRegionVpcProfileT is like GetMultiRegionVpcProfileE but fails the test if the profile cannot be assigned.
+// The VPCs are released when the test finishes, unless the test failed.
+func (ca *CidrAssigner) GetMultiRegionVpcProfileT(t testing.TB, regions ...string) *MultiRegionVpcProfile {
+	t.Helper()
+	profile, err := ca.GetMultiRegionVpcProfileE(regions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cidrs := make([]string, 0, len(profile.Vpcs))
+	for _, vpc := range profile.Vpcs {
+		cidrs = append(cidrs, vpc.IPRange)
+	}
+	ca.releaseOnCleanup(t, cidrs...)
+	return profile
+}
+
+// GetMultiRegionVpcProfile allocates a /24 VPC for each region.
+// It will fatal the test if the profile cannot be assigned.
+func (ca *CidrAssigner) GetMultiRegionVpcProfile(regions ...string) *MultiRegionVpcProfile {
+	profile, err := ca.GetMultiRegionVpcProfileE(regions...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return profile
+}
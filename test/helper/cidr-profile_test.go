@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCidrSource wraps a CidrSource and counts how many times it is listed
+type countingCidrSource struct {
+	CidrSource
+	calls int
+}
+
+func (s *countingCidrSource) Ranges(ctx context.Context) ([]CidrRange, error) {
+	s.calls++
+	return s.CidrSource.Ranges(ctx)
+}
+
+// failingCidrLeaseStore fails the nth Acquire call
+type failingCidrLeaseStore struct {
+	CidrLeaseStore
+	failOn int
+	calls  int
+}
+
+func (s *failingCidrLeaseStore) Acquire(ctx context.Context, cidr, owner string, ttl time.Duration) (*CidrLease, error) {
+	s.calls++
+	if s.calls == s.failOn {
+		return nil, errors.New("ledger unavailable")
+	}
+	return s.CidrLeaseStore.Acquire(ctx, cidr, owner, ttl)
+}
+
+func TestCidrAssigner_GetDoksNetworkProfile(t *testing.T) {
+	source := &countingCidrSource{CidrSource: NewStaticCidrSource("existing", "10.0.0.0/24")}
+	assigner := NewCidrAssigner(context.Background(), nil, source)
+
+	profile, err := assigner.GetDoksNetworkProfileE()
+	require.NoError(t, err)
+	assert.Equal(t, &DoksNetworkProfile{
+		VpcCidr:     "10.0.1.0/24",
+		ClusterCidr: "10.0.32.0/19",
+		ServiceCidr: "10.0.4.0/22",
+	}, profile)
+	assert.Equal(t, 1, source.calls, "the profile should be allocated from a single inventory snapshot")
+}
+
+func TestCidrAssigner_GetMultiRegionVpcProfile(t *testing.T) {
+	assigner := NewCidrAssigner(context.Background(), nil, NewStaticCidrSource("existing", "10.0.1.0/24"))
+
+	profile, err := assigner.GetMultiRegionVpcProfileE("nyc3", "sfo3", "ams3")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"region": "nyc3", "ip_range": "10.0.0.0/24"},
+		map[string]interface{}{"region": "sfo3", "ip_range": "10.0.2.0/24"},
+		map[string]interface{}{"region": "ams3", "ip_range": "10.0.3.0/24"},
+	}, profile.TerraformValue())
+}
+
+func TestCidrAssigner_ProfileIsAllOrNothing(t *testing.T) {
+	store := NewFileCidrLeaseStore(filepath.Join(t.TempDir(), "leases.json"))
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:    []CidrSource{NewStaticCidrSource("existing")},
+		LeaseStore: &failingCidrLeaseStore{CidrLeaseStore: store, failOn: 3},
+	})
+
+	_, err := assigner.GetDoksNetworkProfileE()
+	assert.EqualError(t, err, "failed to get DOKS network profile: failed to lease CIDR 10.0.36.0/24: ledger unavailable")
+
+	// The cluster and service leases taken before the failure have been released
+	leases, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, leases)
+
+	// And the assigner is not tracking them
+	cidr, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/24", cidr)
+}
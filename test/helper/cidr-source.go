@@ -0,0 +1,276 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
+)
+
+// CidrRange is a network that is already in use and must not be allocated again.
+type CidrRange struct {
+	Cidr   string // Network in CIDR notation (e.g. "10.0.0.0/24")
+	Owner  string // Resource the network belongs to (e.g. a VPC or cluster name)
+	Source string // Name of the CidrSource that reported it
+}
+
+// CidrSource reports networks that are in use somewhere a reference architecture needs to route to,
+// so that CidrAssigner never hands out an overlapping block.
+type CidrSource interface {
+	// Name identifies the source in errors and in CidrRange.Source.
+	Name() string
+	// Ranges returns every network the source currently knows about.
+	Ranges(ctx context.Context) ([]CidrRange, error)
+}
+
+// DefaultCidrSources returns the sources NewCidrAssigner uses when none are given:
+// the account's VPCs and DOKS clusters.
+func DefaultCidrSources(client *godo.Client) []CidrSource {
+	return []CidrSource{
+		NewVpcCidrSource(client.VPCs),
+		NewDoksClusterCidrSource(client.Kubernetes),
+	}
+}
+
+// VpcCidrSource reports the IP ranges of every VPC in a DigitalOcean account.
+type VpcCidrSource struct {
+	vpcs doservice.VpcLister
+}
+
+// NewVpcCidrSource creates a VpcCidrSource. vpcs is usually godo.Client.VPCs.
+func NewVpcCidrSource(vpcs doservice.VpcLister) *VpcCidrSource {
+	return &VpcCidrSource{vpcs: vpcs}
+}
+
+// Name implements CidrSource.
+func (s *VpcCidrSource) Name() string {
+	return "digitalocean-vpc"
+}
+
+// Ranges implements CidrSource.
+func (s *VpcCidrSource) Ranges(ctx context.Context) ([]CidrRange, error) {
+	vpcs, err := listAllPages(func(opt *godo.ListOptions) ([]*godo.VPC, *godo.Response, error) {
+		return s.vpcs.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []CidrRange
+	for _, vpc := range vpcs {
+		ranges = append(ranges, CidrRange{Cidr: vpc.IPRange, Owner: vpc.Name, Source: s.Name()})
+	}
+	return ranges, nil
+}
+
+// DoksClusterCidrSource reports the cluster and service subnets of every DOKS cluster in a DigitalOcean account.
+type DoksClusterCidrSource struct {
+	clusters doservice.KubernetesClusterLister
+}
+
+// NewDoksClusterCidrSource creates a DoksClusterCidrSource. clusters is usually godo.Client.Kubernetes.
+func NewDoksClusterCidrSource(clusters doservice.KubernetesClusterLister) *DoksClusterCidrSource {
+	return &DoksClusterCidrSource{clusters: clusters}
+}
+
+// Name implements CidrSource.
+func (s *DoksClusterCidrSource) Name() string {
+	return "doks-cluster"
+}
+
+// Ranges implements CidrSource.
+func (s *DoksClusterCidrSource) Ranges(ctx context.Context) ([]CidrRange, error) {
+	clusters, err := listAllPages(func(opt *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error) {
+		return s.clusters.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []CidrRange
+	for _, cluster := range clusters {
+		if cluster.ClusterSubnet != "" {
+			ranges = append(ranges, CidrRange{Cidr: cluster.ClusterSubnet, Owner: cluster.Name, Source: s.Name()})
+		}
+		if cluster.ServiceSubnet != "" {
+			ranges = append(ranges, CidrRange{Cidr: cluster.ServiceSubnet, Owner: cluster.Name, Source: s.Name()})
+		}
+	}
+	return ranges, nil
+}
+
+// PartnerAttachmentRouteCidrSource reports the remote routes advertised to Partner Network Connect attachments.
+type PartnerAttachmentRouteCidrSource struct {
+	attachments   doservice.PartnerAttachmentRouteLister
+	attachmentIDs []string
+}
+
+// NewPartnerAttachmentRouteCidrSource creates a PartnerAttachmentRouteCidrSource for the given attachments,
+// or for every attachment in the account if none are given. attachments is usually godo.Client.PartnerAttachment.
+func NewPartnerAttachmentRouteCidrSource(attachments doservice.PartnerAttachmentRouteLister, attachmentIDs ...string) *PartnerAttachmentRouteCidrSource {
+	return &PartnerAttachmentRouteCidrSource{attachments: attachments, attachmentIDs: attachmentIDs}
+}
+
+// Name implements CidrSource.
+func (s *PartnerAttachmentRouteCidrSource) Name() string {
+	return "partner-attachment-route"
+}
+
+// Ranges implements CidrSource.
+func (s *PartnerAttachmentRouteCidrSource) Ranges(ctx context.Context) ([]CidrRange, error) {
+	attachmentIDs := s.attachmentIDs
+	if len(attachmentIDs) == 0 {
+		attachments, err := listAllPages(func(opt *godo.ListOptions) ([]*godo.PartnerAttachment, *godo.Response, error) {
+			return s.attachments.List(ctx, opt)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list partner attachments: %w", err)
+		}
+		for _, attachment := range attachments {
+			attachmentIDs = append(attachmentIDs, attachment.ID)
+		}
+	}
+
+	var ranges []CidrRange
+	for _, id := range attachmentIDs {
+		routes, err := listAllPages(func(opt *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error) {
+			return s.attachments.ListRoutes(ctx, id, opt)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list routes for partner attachment %s: %w", id, err)
+		}
+		for _, route := range routes {
+			ranges = append(ranges, CidrRange{Cidr: route.Cidr, Owner: id, Source: s.Name()})
+		}
+	}
+	return ranges, nil
+}
+
+// AwsVpcCidrSource reports the IPv4 and IPv6 CIDR blocks associated with every VPC visible to an EC2 client.
+type AwsVpcCidrSource struct {
+	client ec2.DescribeVpcsAPIClient
+}
+
+// NewAwsVpcCidrSource creates an AwsVpcCidrSource. client is usually an *ec2.Client for the region the
+// reference architecture deploys to.
+func NewAwsVpcCidrSource(client ec2.DescribeVpcsAPIClient) *AwsVpcCidrSource {
+	return &AwsVpcCidrSource{client: client}
+}
+
+// Name implements CidrSource.
+func (s *AwsVpcCidrSource) Name() string {
+	return "aws-vpc"
+}
+
+// Ranges implements CidrSource.
+func (s *AwsVpcCidrSource) Ranges(ctx context.Context) ([]CidrRange, error) {
+	var ranges []CidrRange
+	paginator := ec2.NewDescribeVpcsPaginator(s.client, &ec2.DescribeVpcsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, vpc := range page.Vpcs {
+			owner := aws.ToString(vpc.VpcId)
+			for _, association := range vpc.CidrBlockAssociationSet {
+				if isDisassociated(association.CidrBlockState) {
+					continue
+				}
+				ranges = append(ranges, CidrRange{Cidr: aws.ToString(association.CidrBlock), Owner: owner, Source: s.Name()})
+			}
+			for _, association := range vpc.Ipv6CidrBlockAssociationSet {
+				if isDisassociated(association.Ipv6CidrBlockState) {
+					continue
+				}
+				ranges = append(ranges, CidrRange{Cidr: aws.ToString(association.Ipv6CidrBlock), Owner: owner, Source: s.Name()})
+			}
+		}
+	}
+	return ranges, nil
+}
+
+// isDisassociated reports whether a VPC CIDR block association no longer holds its block.
+func isDisassociated(state *ec2Types.VpcCidrBlockState) bool {
+	if state == nil {
+		return false
+	}
+	switch state.State {
+	case ec2Types.VpcCidrBlockStateCodeDisassociated, ec2Types.VpcCidrBlockStateCodeFailed:
+		return true
+	}
+	return false
+}
+
+// StaticCidrSource reports a fixed list of networks, e.g. ranges hard-coded in test.tfvars.
+type StaticCidrSource struct {
+	name  string
+	cidrs []string
+}
+
+// NewStaticCidrSource creates a StaticCidrSource named name that reports cidrs.
+func NewStaticCidrSource(name string, cidrs ...string) *StaticCidrSource {
+	return &StaticCidrSource{name: name, cidrs: cidrs}
+}
+
+// Name implements CidrSource.
+func (s *StaticCidrSource) Name() string {
+	return s.name
+}
+
+// Ranges implements CidrSource.
+func (s *StaticCidrSource) Ranges(context.Context) ([]CidrRange, error) {
+	ranges := make([]CidrRange, 0, len(s.cidrs))
+	for _, cidr := range s.cidrs {
+		ranges = append(ranges, CidrRange{Cidr: cidr, Owner: s.name, Source: s.name})
+	}
+	return ranges, nil
+}
+
+// collectCidrRanges queries every source and returns their combined ranges.
+func collectCidrRanges(ctx context.Context, sources []CidrSource) ([]CidrRange, error) {
+	var ranges []CidrRange
+	for _, source := range sources {
+		sourceRanges, err := source.Ranges(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CIDRs from %s: %w", source.Name(), err)
+		}
+		ranges = append(ranges, sourceRanges...)
+	}
+	return ranges, nil
+}
+
+// listAllPages calls list for every page of a paginated godo List endpoint and returns all items.
+func listAllPages[T any](list func(opt *godo.ListOptions) ([]T, *godo.Response, error)) ([]T, error) {
+	var items []T
+	opt := &godo.ListOptions{
+		Page:    1,
+		PerPage: 100,
+	}
+
+	for {
+		page, resp, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		// Check if we need to paginate
+		if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		// Get the next page
+		current, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+		opt.Page = current + 1
+	}
+
+	return items, nil
+}
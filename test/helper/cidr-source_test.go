@@ -0,0 +1,198 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice/doservicefakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDescribeVpcs returns its pages of VPCs in order, following NextToken.
+type mockDescribeVpcs struct {
+	pages [][]ec2Types.Vpc
+	err   error
+}
+
+func (m *mockDescribeVpcs) DescribeVpcs(_ context.Context, params *ec2.DescribeVpcsInput, _ ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := 0
+	if params.NextToken != nil {
+		page = int((*params.NextToken)[0] - '0')
+	}
+	out := &ec2.DescribeVpcsOutput{Vpcs: m.pages[page]}
+	if page+1 < len(m.pages) {
+		out.NextToken = aws.String(string(rune('0' + page + 1)))
+	}
+	return out, nil
+}
+
+func TestVpcAndDoksClusterCidrSources(t *testing.T) {
+	sources := fakeCidrSources(
+		[]*godo.VPC{{Name: "vpc-a", IPRange: "10.0.0.0/24"}},
+		[]*godo.KubernetesCluster{
+			{Name: "doks-a", ClusterSubnet: "10.1.0.0/19", ServiceSubnet: "10.2.0.0/22"},
+			{Name: "doks-b"},
+		},
+	)
+
+	ranges, err := collectCidrRanges(context.Background(), sources)
+	require.NoError(t, err)
+	assert.Equal(t, []CidrRange{
+		{Cidr: "10.0.0.0/24", Owner: "vpc-a", Source: "digitalocean-vpc"},
+		{Cidr: "10.1.0.0/19", Owner: "doks-a", Source: "doks-cluster"},
+		{Cidr: "10.2.0.0/22", Owner: "doks-a", Source: "doks-cluster"},
+	}, ranges)
+}
+
+func TestVpcCidrSource_Error(t *testing.T) {
+	vpcLister := &doservicefakes.FakeVpcLister{}
+	vpcLister.ListReturns(nil, nil, errors.New("unauthorized"))
+
+	_, err := NewVpcCidrSource(vpcLister).Ranges(context.Background())
+	assert.EqualError(t, err, "unauthorized")
+	assert.Equal(t, 1, vpcLister.ListCallCount())
+}
+
+func TestDefaultCidrSources_FakeAPI(t *testing.T) {
+	server, client := newFakeClient(t)
+	// listAllPages asks for 100 per page, so 150 VPCs take two pages
+	for i := 0; i < 150; i++ {
+		server.AddVPC(godo.VPC{Name: fmt.Sprintf("vpc-%d", i), IPRange: fmt.Sprintf("10.%d.%d.0/24", i/100, i%100)})
+	}
+	server.AddKubernetesCluster(godo.KubernetesCluster{Name: "doks-a", ClusterSubnet: "10.200.0.0/19", ServiceSubnet: "10.201.0.0/22"}, nil)
+
+	ranges, err := collectCidrRanges(context.Background(), DefaultCidrSources(client))
+	require.NoError(t, err)
+	require.Len(t, ranges, 152)
+	assert.Equal(t, CidrRange{Cidr: "10.1.49.0/24", Owner: "vpc-149", Source: "digitalocean-vpc"}, ranges[149])
+	assert.Equal(t, CidrRange{Cidr: "10.201.0.0/22", Owner: "doks-a", Source: "doks-cluster"}, ranges[151])
+	vpcPages := 0
+	for _, request := range server.Requests() {
+		if request == "GET /v2/vpcs" {
+			vpcPages++
+		}
+	}
+	assert.Equal(t, 2, vpcPages)
+}
+
+func TestVpcCidrSource_Cassette(t *testing.T) {
+	ranges, err := NewVpcCidrSource(newCassetteClient(t).VPCs).Ranges(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []CidrRange{
+		{Cidr: "10.116.0.0/20", Owner: "default-nyc3", Source: "digitalocean-vpc"},
+		{Cidr: "10.200.0.0/24", Owner: "test-nat-gateway-vpc", Source: "digitalocean-vpc"},
+		{Cidr: "172.16.8.0/22", Owner: "test-doks-vpc", Source: "digitalocean-vpc"},
+	}, ranges)
+}
+
+func TestDoksClusterCidrSource_Cassette(t *testing.T) {
+	ranges, err := NewDoksClusterCidrSource(newCassetteClient(t).Kubernetes).Ranges(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []CidrRange{
+		{Cidr: "10.244.0.0/16", Owner: "prod-doks", Source: "doks-cluster"},
+		{Cidr: "10.245.0.0/16", Owner: "prod-doks", Source: "doks-cluster"},
+		{Cidr: "172.16.64.0/19", Owner: "test-doks", Source: "doks-cluster"},
+		{Cidr: "172.16.96.0/22", Owner: "test-doks", Source: "doks-cluster"},
+	}, ranges)
+}
+
+func TestPartnerAttachmentRouteCidrSource(t *testing.T) {
+	routes := map[string][]*godo.RemoteRoute{
+		"pa-1": {{Cidr: "192.168.0.0/24"}},
+		"pa-2": {{Cidr: "192.168.1.0/24"}, {Cidr: "192.168.2.0/24"}},
+	}
+	attachments := &doservicefakes.FakePartnerAttachmentRouteLister{}
+	attachments.ListReturns([]*godo.PartnerAttachment{{ID: "pa-1"}, {ID: "pa-2"}}, &godo.Response{Links: &godo.Links{}}, nil)
+	attachments.ListRoutesStub = func(_ context.Context, id string, _ *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error) {
+		return routes[id], &godo.Response{Links: &godo.Links{}}, nil
+	}
+
+	t.Run("All attachments", func(t *testing.T) {
+		ranges, err := NewPartnerAttachmentRouteCidrSource(attachments).Ranges(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []CidrRange{
+			{Cidr: "192.168.0.0/24", Owner: "pa-1", Source: "partner-attachment-route"},
+			{Cidr: "192.168.1.0/24", Owner: "pa-2", Source: "partner-attachment-route"},
+			{Cidr: "192.168.2.0/24", Owner: "pa-2", Source: "partner-attachment-route"},
+		}, ranges)
+	})
+
+	t.Run("Selected attachments", func(t *testing.T) {
+		ranges, err := NewPartnerAttachmentRouteCidrSource(attachments, "pa-1").Ranges(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []CidrRange{{Cidr: "192.168.0.0/24", Owner: "pa-1", Source: "partner-attachment-route"}}, ranges)
+	})
+}
+
+func TestAwsVpcCidrSource(t *testing.T) {
+	associated := &ec2Types.VpcCidrBlockState{State: ec2Types.VpcCidrBlockStateCodeAssociated}
+	disassociated := &ec2Types.VpcCidrBlockState{State: ec2Types.VpcCidrBlockStateCodeDisassociated}
+	client := &mockDescribeVpcs{pages: [][]ec2Types.Vpc{
+		{{
+			VpcId: aws.String("vpc-1"),
+			CidrBlockAssociationSet: []ec2Types.VpcCidrBlockAssociation{
+				{CidrBlock: aws.String("172.31.0.0/16"), CidrBlockState: associated},
+				{CidrBlock: aws.String("100.64.0.0/16"), CidrBlockState: disassociated},
+			},
+		}},
+		{{
+			VpcId: aws.String("vpc-2"),
+			CidrBlockAssociationSet: []ec2Types.VpcCidrBlockAssociation{
+				{CidrBlock: aws.String("192.168.100.0/24")},
+			},
+			Ipv6CidrBlockAssociationSet: []ec2Types.VpcIpv6CidrBlockAssociation{
+				{Ipv6CidrBlock: aws.String("2600:1f14::/56"), Ipv6CidrBlockState: associated},
+			},
+		}},
+	}}
+
+	ranges, err := NewAwsVpcCidrSource(client).Ranges(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []CidrRange{
+		{Cidr: "172.31.0.0/16", Owner: "vpc-1", Source: "aws-vpc"},
+		{Cidr: "192.168.100.0/24", Owner: "vpc-2", Source: "aws-vpc"},
+		{Cidr: "2600:1f14::/56", Owner: "vpc-2", Source: "aws-vpc"},
+	}, ranges)
+}
+
+func TestCidrAssigner_Sources(t *testing.T) {
+	t.Run("Avoid every source", func(t *testing.T) {
+		ec2Client := &mockDescribeVpcs{pages: [][]ec2Types.Vpc{{{
+			VpcId:                   aws.String("vpc-1"),
+			CidrBlockAssociationSet: []ec2Types.VpcCidrBlockAssociation{{CidrBlock: aws.String("192.168.0.0/24")}},
+		}}}}
+		assigner := NewCidrAssigner(context.Background(), nil,
+			NewAwsVpcCidrSource(ec2Client),
+			NewStaticCidrSource("test.tfvars", "192.168.1.0/24"),
+		)
+
+		cidr, err := assigner.GetCidrBlockFromPool("192.168.0.0/16", 24)
+		require.NoError(t, err)
+		assert.Equal(t, "192.168.2.0/24", cidr)
+	})
+
+	t.Run("Report the failing source", func(t *testing.T) {
+		assigner := NewCidrAssigner(context.Background(), nil,
+			NewStaticCidrSource("test.tfvars", "10.0.0.0/24"),
+			NewAwsVpcCidrSource(&mockDescribeVpcs{err: errors.New("access denied")}),
+		)
+
+		_, err := assigner.GetVpcCidrE()
+		assert.EqualError(t, err, "failed to get VPC CIDR: failed to get existing CIDR blocks: failed to get CIDRs from aws-vpc: access denied")
+	})
+
+	t.Run("Require a client or sources", func(t *testing.T) {
+		_, err := NewCidrAssigner(context.Background(), nil).GetVpcCidrE()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,71 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+)
+
+// NewSupernetCidrAssigner creates a CidrAssigner that carves blocks out of supernet (e.g. a /16 reserved for
+// a test run) instead of searching the account. The supernet is assumed to be free already, so the assigner
+// has no sources, exclusions or lease store, and its getters hand out the lowest free blocks: the same
+// sequence of calls always yields the same blocks. Every getter works as usual but never leaves the supernet.
+func NewSupernetCidrAssigner(ctx context.Context, supernet string) (*CidrAssigner, error) {
+	pool, err := parseCidrPool(supernet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid supernet: %w", err)
+	}
+	ca := NewCidrAssignerWithOptions(ctx, nil, &CidrAssignerOptions{
+		Pool:                pool.prefix.String(),
+		Sources:             []CidrSource{NewStaticCidrSource("supernet")},
+		IgnoreReservedCidrs: true, // The supernet was allocated clear of them
+	})
+	ca.supernet = pool
+	return ca, nil
+}
+
+// Supernet returns the network a supernet assigner carves blocks from, or "" if it searches the whole pool.
+func (ca *CidrAssigner) Supernet() string {
+	if ca.supernet == nil {
+		return ""
+	}
+	return ca.supernet.prefix.String()
+}
+
+// GetSupernetAssignerE allocates a block of prefixLength (e.g. 16) from the assigner's pool and returns
+// an assigner that carves blocks out of it, so everything a test run creates sits in one contiguous range.
+// The supernet is held (and leased) by ca until it is released with ca.Release(child.Supernet()).
+func (ca *CidrAssigner) GetSupernetAssignerE(prefixLength int) (*CidrAssigner, error) {
+	supernet, err := ca.GetCidrBlockFromPool(ca.pool, prefixLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get supernet: %w", err)
+	}
+	child, err := NewSupernetCidrAssigner(ca.ctx, supernet)
+	if err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// GetSupernetAssignerT is like GetSupernetAssignerE but fails the test if the supernet cannot be assigned.
+// The supernet is released when the test finishes, unless the test failed.
+func (ca *CidrAssigner) GetSupernetAssignerT(t testing.TB, prefixLength int) *CidrAssigner {
+	t.Helper()
+	child, err := ca.GetSupernetAssignerE(prefixLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.releaseOnCleanup(t, child.Supernet())
+	return child
+}
+
+// GetSupernetAssigner allocates a supernet of prefixLength and returns an assigner that carves blocks out of it.
+// It will fatal the test if the supernet cannot be assigned.
+func (ca *CidrAssigner) GetSupernetAssigner(prefixLength int) *CidrAssigner {
+	child, err := ca.GetSupernetAssignerE(prefixLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return child
+}
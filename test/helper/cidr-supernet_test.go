@@ -0,0 +1,87 @@
+package helper
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCidrAssigner_GetSupernetAssigner(t *testing.T) {
+	store := NewFileCidrLeaseStore(filepath.Join(t.TempDir(), "leases.json"))
+	parent := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:    []CidrSource{NewStaticCidrSource("existing", "10.0.0.0/24")},
+		LeaseStore: store,
+	})
+
+	child, err := parent.GetSupernetAssignerE(16)
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.0.0/16", child.Supernet())
+	assert.Empty(t, parent.Supernet())
+
+	// Blocks are carved from the supernet, lowest first, with no alignment gaps between the profile's networks
+	profile, err := child.GetDoksNetworkProfileE()
+	require.NoError(t, err)
+	assert.Equal(t, &DoksNetworkProfile{
+		VpcCidr:     "10.1.36.0/24",
+		ClusterCidr: "10.1.0.0/19",
+		ServiceCidr: "10.1.32.0/22",
+	}, profile)
+	cidr, err := child.GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.37.0/24", cidr)
+	cidr, err = child.GetCidrBlock("10.1.128.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.128.0/24", cidr)
+
+	// Only the supernet itself is leased
+	leases, err := store.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.Equal(t, "10.1.0.0/16", leases[0].Cidr)
+
+	// The child never leaves the supernet
+	_, err = child.GetCidrBlock("10.2.0.0", 24)
+	assert.EqualError(t, err, "base network 10.2.0.0 is outside the supernet 10.1.0.0/16")
+	_, err = child.GetCidrBlockFromPool("10.0.0.0/8", 24)
+	assert.EqualError(t, err, "CIDR pool 10.0.0.0/8 is outside the supernet 10.1.0.0/16")
+	_, err = child.GetCidrBlockFromPool("10.1.0.0/24", 28)
+	assert.ErrorIs(t, err, ErrCidrPoolExhausted)
+}
+
+func TestNewSupernetCidrAssigner_IsDeterministic(t *testing.T) {
+	// A lease store named by the environment is not used, or the second run would get different blocks
+	t.Setenv("CIDR_LEASE_URL", "")
+	t.Setenv("CIDR_LEASE_FILE", filepath.Join(t.TempDir(), "leases.json"))
+
+	var runs [][]string
+	for i := 0; i < 2; i++ {
+		assigner, err := NewSupernetCidrAssigner(context.Background(), "172.20.0.0/16")
+		require.NoError(t, err)
+		cidrs, err := assigner.GetCidrBlocksFromPool(assigner.Supernet(), 22, 24, 24, 19)
+		require.NoError(t, err)
+		runs = append(runs, cidrs)
+	}
+	assert.Equal(t, []string{"172.20.0.0/22", "172.20.4.0/24", "172.20.5.0/24", "172.20.32.0/19"}, runs[0])
+	assert.Equal(t, runs[0], runs[1])
+
+	_, err := NewSupernetCidrAssigner(context.Background(), "8.8.0.0/16")
+	assert.EqualError(t, err, "invalid supernet: CIDR pool 8.8.0.0/16 is not entirely private (RFC1918 or unique local) address space")
+}
+
+func TestCidrAssigner_GetSupernetAssignerT(t *testing.T) {
+	parent := NewCidrAssigner(context.Background(), nil, NewStaticCidrSource("existing"))
+	recorder := &cleanupRecorder{TB: t, name: "TestApplyAndDestroy"}
+
+	child := parent.GetSupernetAssignerT(recorder, 16)
+	child.GetVpcCidrT(recorder)
+	require.Len(t, parent.Allocations(), 1)
+	assert.Equal(t, "TestApplyAndDestroy", parent.Allocations()[0].Test)
+
+	recorder.runCleanups()
+	assert.False(t, recorder.failed, "cleanup should not report errors")
+	assert.Empty(t, parent.Allocations())
+	assert.Empty(t, child.Allocations())
+}
@@ -0,0 +1,107 @@
+package helper
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"net/netip"
+)
+
+// CidrPoolUsage describes how much of a pool is in use and how fragmented the free space is.
+type CidrPoolUsage struct {
+	Pool              string    // Pool in CIDR notation (e.g. "10.0.0.0/8")
+	UsedAddresses     *big.Int  // Addresses covered by existing networks, exclusions, allocations and leases
+	FreeAddresses     *big.Int  // Addresses not in use
+	FreeFragments     int       // Number of separate free ranges
+	LargestFreePrefix int       // Prefix length of the largest free block, or 0 if the pool is full
+	Cells             []float64 // Fraction of each equal slice of the pool that is in use, lowest addresses first
+}
+
+// FreeBlocks lists the free blocks of prefixLength in pool (e.g. "10.0.0.0/8"), lowest first, without allocating them.
+// At most limit blocks are returned; a limit of zero or less returns every free block.
+func (ca *CidrAssigner) FreeBlocks(pool string, prefixLength, limit int) ([]string, error) {
+	cidrPool, err := parseCidrPool(pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := cidrPool.validatePrefixLength(prefixLength); err != nil {
+		return nil, err
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	used, err := ca.poolIndex(cidrPool)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []string
+	hostBits := cidrPool.bits - prefixLength
+	from := cidrPool.first
+	for limit <= 0 || len(blocks) < limit {
+		found, ok := used.firstFit(hostBits, from)
+		if !ok {
+			break
+		}
+		blocks = append(blocks, netip.PrefixFrom(addrFromUint128(found, cidrPool.bits), prefixLength).String())
+		if found.add(pow2(hostBits)).subOne().cmp(cidrPool.last) >= 0 {
+			break // Reached the end of the pool
+		}
+		from = found.add(pow2(hostBits))
+	}
+	return blocks, nil
+}
+
+// PoolUsage summarises how much of pool (e.g. "10.0.0.0/8") is in use. The pool is divided into cells
+// equal slices for CidrPoolUsage.Cells; cells must be a power of two no larger than the pool.
+func (ca *CidrAssigner) PoolUsage(pool string, cells int) (*CidrPoolUsage, error) {
+	cidrPool, err := parseCidrPool(pool)
+	if err != nil {
+		return nil, err
+	}
+	poolHostBits := cidrPool.bits - cidrPool.prefix.Bits()
+	if cells < 1 || bits.OnesCount(uint(cells)) != 1 || bits.Len(uint(cells))-1 > poolHostBits {
+		return nil, fmt.Errorf("cells must be a power of two no larger than the pool %s, got %d", pool, cells)
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	used, err := ca.poolIndex(cidrPool)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &CidrPoolUsage{
+		Pool:          cidrPool.prefix.String(),
+		FreeAddresses: used.freeAddresses().big(),
+		FreeFragments: used.freeFragments(),
+		Cells:         make([]float64, cells),
+	}
+	usage.UsedAddresses = new(big.Int).Sub(cidrPool.last.sub(cidrPool.first).addOne().big(), usage.FreeAddresses)
+	if largest := used.largestFreeBlock(); largest >= 0 {
+		usage.LargestFreePrefix = cidrPool.bits - largest
+	}
+
+	// Walk the cells and the used ranges together, adding up the part of each range inside each cell
+	cellSize := pow2(poolHostBits - (bits.Len(uint(cells)) - 1))
+	usedRanges := used.usedRanges()
+	first, j := cidrPool.first, 0
+	for i := range usage.Cells {
+		last := first.add(cellSize).subOne()
+		var inUse uint128
+		for ; j < len(usedRanges) && usedRanges[j].first.cmp(last) <= 0; j++ {
+			r := usedRanges[j]
+			if r.first.cmp(first) < 0 {
+				r.first = first
+			}
+			if r.last.cmp(last) > 0 {
+				r.last = last
+			}
+			inUse = inUse.add(r.last.sub(r.first).addOne())
+			if usedRanges[j].last.cmp(last) > 0 {
+				break // Continues into the next cell
+			}
+		}
+		usage.Cells[i] = inUse.float() / cellSize.float()
+		first = last.addOne()
+	}
+	return usage, nil
+}
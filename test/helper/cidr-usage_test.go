@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCidrAssigner_FreeBlocks(t *testing.T) {
+	store := NewFileCidrLeaseStore(filepath.Join(t.TempDir(), "leases.json"))
+	_, err := store.Acquire(context.Background(), "192.168.3.0/24", "someone-else", time.Hour)
+	require.NoError(t, err)
+
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:       []CidrSource{NewStaticCidrSource("existing", "192.168.0.0/23", "192.168.4.128/25")},
+		ExcludedCidrs: []string{"192.168.6.0/24"},
+		LeaseStore:    store,
+	})
+
+	blocks, err := assigner.FreeBlocks("192.168.0.0/16", 24, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.2.0/24", "192.168.5.0/24", "192.168.7.0/24", "192.168.8.0/24"}, blocks)
+
+	blocks, err = assigner.FreeBlocks("192.168.0.0/21", 23, 0)
+	require.NoError(t, err)
+	assert.Empty(t, blocks, "every /23 in the pool is partly used")
+
+	blocks, err = assigner.FreeBlocks("192.168.0.0/21", 25, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.2.0/25", "192.168.2.128/25", "192.168.4.0/25", "192.168.5.0/25", "192.168.5.128/25", "192.168.7.0/25", "192.168.7.128/25"}, blocks)
+
+	_, err = assigner.FreeBlocks("192.168.0.0/16", 12, 0)
+	assert.EqualError(t, err, "prefix length /12 is larger than the pool 192.168.0.0/16")
+}
+
+func TestCidrAssigner_PoolUsage(t *testing.T) {
+	assigner := NewCidrAssigner(context.Background(), nil, NewStaticCidrSource("existing", "192.168.0.0/18", "192.168.96.0/20"))
+
+	usage, err := assigner.PoolUsage("192.168.0.0/16", 4)
+	require.NoError(t, err)
+	assert.Equal(t, &CidrPoolUsage{
+		Pool:              "192.168.0.0/16",
+		UsedAddresses:     big.NewInt(20480),
+		FreeAddresses:     big.NewInt(45056),
+		FreeFragments:     2,
+		LargestFreePrefix: 17,
+		Cells:             []float64{1, 0.25, 0, 0},
+	}, usage)
+
+	_, err = assigner.PoolUsage("192.168.0.0/16", 3)
+	assert.EqualError(t, err, "cells must be a power of two no larger than the pool 192.168.0.0/16, got 3")
+}
@@ -5,276 +5,604 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/digitalocean/godo"
 )
 
-// CidrAssigner manages CIDR block allocation.
+// DigitalOceanReservedCidrs are ranges DigitalOcean reserves or uses as platform defaults.
+// Creating a VPC or DOKS cluster that overlaps them fails (or misbehaves) at apply time,
+// so CidrAssigner never hands them out unless CidrAssignerOptions.IgnoreReservedCidrs is set.
+var DigitalOceanReservedCidrs = []string{
+	"10.244.0.0/16",  // Default DOKS pod network
+	"10.245.0.0/16",  // Default DOKS service network
+	"10.246.0.0/24",  // Reserved by DOKS for internal use
+	"10.229.0.0/16",  // Reserved for DigitalOcean internal services
+	"10.10.0.0/16",   // Legacy private networking in older regions
+	"172.17.0.0/16",  // Docker default bridge on Droplet images
+	"169.254.0.0/16", // Link-local, including the metadata service
+}
+
+// ErrCidrNotAllocated is matched (via errors.Is) by errors returned when releasing a block the assigner does not hold.
+var ErrCidrNotAllocated = errors.New("CIDR not allocated by this assigner")
+
+// CidrAllocation is a block handed out by a CidrAssigner that has not been released or expired.
+type CidrAllocation struct {
+	Cidr      string    // Allocated block (e.g. "10.0.1.0/24")
+	Test      string    // Name of the test that owns the block, if it was allocated with a T getter
+	ExpiresAt time.Time // When the allocation and its lease expire unless renewed; zero without a lease store, as it never expires
+}
+
+// DefaultCidrInventoryTTL is how long CidrAssigner reuses its listing of existing networks before listing them again.
+const DefaultCidrInventoryTTL = 5 * time.Minute
+
+// CidrAssigner manages CIDR block allocation. It is safe for concurrent use, so one assigner can be
+// shared by parallel tests and sub-tests.
 type CidrAssigner struct {
-	ctx            context.Context
-	client         *godo.Client
-	allocatedCidrs []string
+	ctx           context.Context
+	mu            sync.Mutex
+	sources       []CidrSource
+	allocations   []CidrAllocation
+	excludedCidrs []string
+	pool          string
+	leaseStore    CidrLeaseStore
+	leaseOwner    string
+	leaseTTL      time.Duration
+	inventory     []CidrRange                 // Cached networks reported by sources
+	inventoryTime time.Time                   // When inventory was listed; zero if it never has been
+	inventoryTTL  time.Duration               // How long inventory is reused; negative disables caching
+	placementSeed string                      // Hashed to where searches start; empty to search from the start of the pool
+	supernet      *cidrPool                   // If set, every block is carved from this network (see NewSupernetCidrAssigner)
+	indexes       map[netip.Prefix]*cidrIndex // Index per pool of the unavailable ranges; cleared when any is removed
+	now           func() time.Time
+}
+
+// CidrAssignerOptions configures the behavior of NewCidrAssignerWithOptions
+type CidrAssignerOptions struct {
+	Pool                string         // Pool the typed getters allocate from (default: DefaultCidrPool)
+	Sources             []CidrSource   // Where existing networks are discovered (default: DefaultCidrSources(client))
+	ExcludedCidrs       []string       // Extra ranges to treat as in use, e.g. a peer network in test.tfvars
+	IgnoreReservedCidrs bool           // Allow allocating from DigitalOceanReservedCidrs (default: false)
+	LeaseStore          CidrLeaseStore // Shared ledger every block must be leased from, e.g. CidrLeaseStoreFromEnv() (default: none, in-memory tracking only)
+	LeaseOwner          string         // Owner recorded on leases (default: DefaultCidrLeaseOwner())
+	LeaseTTL            time.Duration  // How long leases are held before expiring (default: DefaultCidrLeaseTTL)
+	InventoryTTL        time.Duration  // How long existing networks are cached (default: DefaultCidrInventoryTTL; negative disables caching)
+	PlacementSeed       string         // Hashed to where each search starts, e.g. t.Name() or a CI run ID (default: none)
+}
+
+// NewCidrAssigner creates a new CidrAssigner that avoids every network reported by sources.
+// If no sources are given, it avoids the VPCs and DOKS clusters in the account client belongs to.
+func NewCidrAssigner(ctx context.Context, client *godo.Client, sources ...CidrSource) *CidrAssigner {
+	return NewCidrAssignerWithOptions(ctx, client, &CidrAssignerOptions{Sources: sources})
+}
+
+// NewCidrAssignerWithOptions creates a new CidrAssigner configured by opts, which may be nil.
+func NewCidrAssignerWithOptions(ctx context.Context, client *godo.Client, opts *CidrAssignerOptions) *CidrAssigner {
+	ca := &CidrAssigner{
+		ctx:          ctx,
+		pool:         DefaultCidrPool,
+		leaseTTL:     DefaultCidrLeaseTTL,
+		inventoryTTL: DefaultCidrInventoryTTL,
+		now:          time.Now,
+	}
+	if opts == nil || !opts.IgnoreReservedCidrs {
+		ca.excludedCidrs = append(ca.excludedCidrs, DigitalOceanReservedCidrs...)
+	}
+	if opts != nil {
+		if opts.Pool != "" {
+			ca.pool = opts.Pool
+		}
+		ca.sources = opts.Sources
+		ca.excludedCidrs = append(ca.excludedCidrs, opts.ExcludedCidrs...)
+		ca.leaseStore = opts.LeaseStore
+		ca.leaseOwner = opts.LeaseOwner
+		if opts.LeaseTTL > 0 {
+			ca.leaseTTL = opts.LeaseTTL
+		}
+		if opts.InventoryTTL != 0 {
+			ca.inventoryTTL = opts.InventoryTTL
+		}
+		ca.placementSeed = opts.PlacementSeed
+	}
+	if len(ca.sources) == 0 && client != nil {
+		ca.sources = DefaultCidrSources(client)
+	}
+	if ca.leaseStore != nil && ca.leaseOwner == "" {
+		ca.leaseOwner = DefaultCidrLeaseOwner()
+	}
+	return ca
+}
+
+// Exclude marks additional ranges as in use, so they are never allocated by this assigner.
+func (ca *CidrAssigner) Exclude(cidrs ...string) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.excludedCidrs = append(ca.excludedCidrs, cidrs...)
+	for _, index := range ca.indexes {
+		index.insertCidrs(cidrs)
+	}
+}
+
+// Refresh lists the existing networks from every source now, replacing the cached inventory.
+func (ca *CidrAssigner) Refresh() error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	_, err := ca.refreshInventory()
+	return err
 }
 
-// NewCidrAssigner creates a new CidrAssigner.
-func NewCidrAssigner(ctx context.Context, client *godo.Client) *CidrAssigner {
-	return &CidrAssigner{
-		ctx:    ctx,
-		client: client,
+// Inventory returns the existing networks reported by the assigner's sources, listing them
+// only if the cached inventory is older than the inventory TTL.
+func (ca *CidrAssigner) Inventory() ([]CidrRange, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	inventory, err := ca.cachedInventory()
+	if err != nil {
+		return nil, err
 	}
+	return append([]CidrRange{}, inventory...), nil
+}
+
+// cachedInventory returns the cached inventory, refreshing it if it has expired. ca.mu must be held.
+func (ca *CidrAssigner) cachedInventory() ([]CidrRange, error) {
+	if ca.inventoryTTL >= 0 && !ca.inventoryTime.IsZero() && ca.now().Sub(ca.inventoryTime) < ca.inventoryTTL {
+		return ca.inventory, nil
+	}
+	return ca.refreshInventory()
+}
+
+// refreshInventory lists every source and caches the result. ca.mu must be held.
+func (ca *CidrAssigner) refreshInventory() ([]CidrRange, error) {
+	if len(ca.sources) == 0 {
+		return nil, errors.New("no CIDR sources configured: godo client cannot be nil unless sources are given")
+	}
+	inventory, err := collectCidrRanges(ca.ctx, ca.sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing CIDR blocks: %w", err)
+	}
+	ca.inventory = inventory
+	ca.inventoryTime = ca.now()
+	ca.indexes = nil // Networks may have been deleted since the indexes were built
+	return inventory, nil
+}
+
+// GetVpcCidrE returns a free CIDR block for VPCs using a /24 prefix length.
+func (ca *CidrAssigner) GetVpcCidrE() (string, error) {
+	cidr, err := ca.GetCidrBlockFromPool(ca.pool, vpcPrefixLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to get VPC CIDR: %w", err)
+	}
+	return cidr, nil
+}
+
+// GetVpcCidrT is like GetVpcCidrE but fails the test if a CIDR cannot be assigned.
+// The block is released when the test finishes, unless the test failed.
+func (ca *CidrAssigner) GetVpcCidrT(t testing.TB) string {
+	t.Helper()
+	cidr, err := ca.GetVpcCidrE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.releaseOnCleanup(t, cidr)
+	return cidr
 }
 
 // GetVpcCidr returns a free CIDR block for VPCs using a /24 prefix length.
 // It will fatal the test if a CIDR cannot be assigned.
 func (ca *CidrAssigner) GetVpcCidr() string {
-	cidr, err := ca.GetCidrBlock("10.0.0.0", 24)
+	cidr, err := ca.GetVpcCidrE()
 	if err != nil {
-		log.Fatalf("failed to get VPC CIDR: %v", err)
+		log.Fatal(err)
 	}
 	return cidr
 }
 
+// GetDoksClusterCidrE returns a free CIDR block for DOKS cluster network using a /19 prefix length.
+func (ca *CidrAssigner) GetDoksClusterCidrE() (string, error) {
+	cidr, err := ca.GetCidrBlockFromPool(ca.pool, doksClusterPrefixLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to get DOKS cluster CIDR: %w", err)
+	}
+	return cidr, nil
+}
+
+// GetDoksClusterCidrT is like GetDoksClusterCidrE but fails the test if a CIDR cannot be assigned.
+// The block is released when the test finishes, unless the test failed.
+func (ca *CidrAssigner) GetDoksClusterCidrT(t testing.TB) string {
+	t.Helper()
+	cidr, err := ca.GetDoksClusterCidrE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.releaseOnCleanup(t, cidr)
+	return cidr
+}
+
 // GetDoksClusterCidr returns a free CIDR block for DOKS cluster network using a /19 prefix length.
 // It will fatal the test if a CIDR cannot be assigned.
 func (ca *CidrAssigner) GetDoksClusterCidr() string {
-	cidr, err := ca.GetCidrBlock("10.0.0.0", 19)
+	cidr, err := ca.GetDoksClusterCidrE()
 	if err != nil {
-		log.Fatalf("failed to get DOKS cluster CIDR: %v", err)
+		log.Fatal(err)
 	}
 	return cidr
 }
 
-// GetDoksServiceCidr returns a free CIDR block for DOKS service network using a /22 prefix length.
-// It will fatal the test if a CIDR cannot be assigned.
-func (ca *CidrAssigner) GetDoksServiceCidr() string {
-	cidr, err := ca.GetCidrBlock("10.0.0.0", 22)
+// GetDoksServiceCidrE returns a free CIDR block for DOKS service network using a /22 prefix length.
+func (ca *CidrAssigner) GetDoksServiceCidrE() (string, error) {
+	cidr, err := ca.GetCidrBlockFromPool(ca.pool, doksServicePrefixLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to get DOKS service CIDR: %w", err)
+	}
+	return cidr, nil
+}
+
+// GetDoksServiceCidrT is like GetDoksServiceCidrE but fails the test if a CIDR cannot be assigned.
+// The block is released when the test finishes, unless the test failed.
+func (ca *CidrAssigner) GetDoksServiceCidrT(t testing.TB) string {
+	t.Helper()
+	cidr, err := ca.GetDoksServiceCidrE()
 	if err != nil {
-		log.Fatalf("failed to get DOKS service CIDR: %v", err)
+		t.Fatal(err)
 	}
+	ca.releaseOnCleanup(t, cidr)
 	return cidr
 }
 
-// GetCidrBlock returns a non-overlapping CIDR block and tracks it.
-func (ca *CidrAssigner) GetCidrBlock(baseNetwork string, prefixLength int) (string, error) {
-	cidr, err := getCidrBlock(ca.ctx, ca.client, baseNetwork, prefixLength, ca.allocatedCidrs)
+// GetDoksServiceCidr returns a free CIDR block for DOKS service network using a /22 prefix length.
+// It will fatal the test if a CIDR cannot be assigned.
+func (ca *CidrAssigner) GetDoksServiceCidr() string {
+	cidr, err := ca.GetDoksServiceCidrE()
 	if err != nil {
-		return "", err
+		log.Fatal(err)
 	}
-	ca.allocatedCidrs = append(ca.allocatedCidrs, cidr)
-	return cidr, nil
+	return cidr
 }
 
-// getCidrBlock returns a non-overlapping CIDR block for deploying Terraform-based reference architectures.
-// It dynamically assigns a new CIDR block based on existing VPCs and Kubernetes clusters in the DigitalOcean account.
+// GetCidrBlock returns a non-overlapping CIDR block for deploying Terraform-based reference architectures and tracks it.
+// It dynamically assigns a new CIDR block based on the networks reported by the assigner's sources (by default the
+// VPCs and Kubernetes clusters in the DigitalOcean account).
+// The search covers the whole private pool containing baseNetwork (10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16
+// or fd00::/8), starting at baseNetwork and wrapping around, and never returns a block outside that pool.
+// If the assigner has a placement seed, the search starts at the seeded offset in the pool instead of baseNetwork.
+// When a lease store is configured, the block is only returned once it has been leased;
+// blocks leased by other owners are skipped, including ones leased after the search started.
 //
 // Parameters:
-//   - ctx: Context for API calls
-//   - client: Authenticated DigitalOcean API client
-//   - baseNetwork: Base network in CIDR notation without prefix (e.g., "10.0.0.0", "172.16.0.0"). Must be an RFC1918 address.
-//   - prefixLength: Desired subnet mask length (e.g., 24, 26)
+//   - baseNetwork: Base network address without prefix (e.g., "10.0.0.0", "172.16.0.0", "fd00::").
+//     Must be an RFC1918 IPv4 address or an RFC4193 unique local IPv6 address.
+//   - prefixLength: Desired subnet mask length (8-30 for IPv4, e.g. 24; 48-64 for IPv6, e.g. 64)
 //
 // Returns:
-//   - A string containing the next available CIDR block (e.g., "10.0.1.0/24")
+//   - A string containing the next available CIDR block (e.g., "10.0.1.0/24", "fd00:0:0:1::/64")
 //   - An error if no available block is found or if API calls fail
-func getCidrBlock(ctx context.Context, client *godo.Client, baseNetwork string, prefixLength int, allocatedCidrs []string) (string, error) {
-	// Validate inputs
-	if client == nil {
-		return "", errors.New("godo client cannot be nil")
+func (ca *CidrAssigner) GetCidrBlock(baseNetwork string, prefixLength int) (string, error) {
+	pool, start, err := parseBaseNetwork(baseNetwork)
+	if err != nil {
+		return "", err
 	}
-
-	if prefixLength < 8 || prefixLength > 30 {
-		return "", fmt.Errorf("prefix length must be between 8 and 30, got %d", prefixLength)
+	if ca.supernet != nil {
+		if !ca.supernet.prefix.Contains(start) {
+			return "", fmt.Errorf("base network %s is outside the supernet %s", baseNetwork, ca.supernet.prefix)
+		}
+		pool = ca.supernet
 	}
-
-	// Parse the base network
-	baseIP := net.ParseIP(baseNetwork)
-	if baseIP == nil {
-		return "", fmt.Errorf("invalid base network: %s", baseNetwork)
+	cidrs, err := ca.allocate(pool, start, []int{prefixLength})
+	if err != nil {
+		return "", err
 	}
+	return cidrs[0], nil
+}
 
-	// Ensure baseIP is an IPv4 address and a private network
-	baseIP = baseIP.To4()
-	if baseIP == nil {
-		return "", fmt.Errorf("base network must be a valid IPv4 address: %s", baseNetwork)
-	}
-	if !baseIP.IsPrivate() {
-		return "", fmt.Errorf("base network %s is not a private (RFC1918) address", baseNetwork)
+// GetCidrBlockFromPool is like GetCidrBlock but searches the whole of pool (e.g. "10.0.0.0/8", "172.16.0.0/12"),
+// preferring the lowest free block, or the first one after the seeded offset if the assigner has a placement seed.
+// It returns an error matching ErrCidrPoolExhausted if no block of prefixLength is free.
+func (ca *CidrAssigner) GetCidrBlockFromPool(pool string, prefixLength int) (string, error) {
+	cidrs, err := ca.GetCidrBlocksFromPool(pool, prefixLength)
+	if err != nil {
+		return "", err
 	}
+	return cidrs[0], nil
+}
 
-	// Get all existing CIDR blocks from VPCs and Kubernetes clusters
-	existingCIDRs, err := getAllExistingCIDRs(ctx, client)
+// GetCidrBlocksFromPool allocates one block from pool for each of prefixLengths, in order, from a single snapshot
+// of the existing networks. Either every block is allocated (and leased) or none are.
+func (ca *CidrAssigner) GetCidrBlocksFromPool(pool string, prefixLengths ...int) ([]string, error) {
+	cidrPool, err := parseCidrPool(pool)
 	if err != nil {
-		return "", fmt.Errorf("failed to get existing CIDR blocks: %w", err)
+		return nil, err
 	}
-	existingCIDRs = append(existingCIDRs, allocatedCidrs...)
-
-	// Parse all existing CIDRs into network objects
-	existingNetworks := make([]*net.IPNet, 0, len(existingCIDRs))
-	for _, cidr := range existingCIDRs {
-		_, network, err := net.ParseCIDR(cidr)
-		if err != nil {
-			continue // Skip invalid CIDRs
-		}
-		existingNetworks = append(existingNetworks, network)
+	if ca.supernet != nil && !ca.supernet.contains(cidrPool) {
+		return nil, fmt.Errorf("CIDR pool %s is outside the supernet %s", pool, ca.supernet.prefix)
 	}
+	return ca.allocate(cidrPool, netip.Addr{}, prefixLengths)
+}
 
-	// Generate candidate subnets and check for overlaps
-	// Start with the first subnet in the base network
-	baseIPInt := ipToUint32(baseIP)
+// allocate finds a free block in pool for each of prefixLengths, searching from start (or the start of the pool
+// if start is the zero Addr, or the seeded offset if the assigner has a placement seed). The search uses the
+// pool's cached index of existing networks, excluded ranges and blocks already allocated, updated with the
+// leased blocks if a lease store is configured. The blocks are then leased together; if another process leased
+// an overlapping block since the listing, the leases taken so far are released and the search is repeated.
+func (ca *CidrAssigner) allocate(pool *cidrPool, start netip.Addr, prefixLengths []int) ([]string, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
 
-	// Calculate the subnet size
-	subnetSize := uint32(1) << (32 - prefixLength)
+	// Validate inputs
+	for _, prefixLength := range prefixLengths {
+		if err := pool.validatePrefixLength(prefixLength); err != nil {
+			return nil, err
+		}
+	}
 
-	// Try up to 256 different subnets
-	for i := uint32(0); i < 256; i++ {
-		// Calculate the start IP for this subnet
-		startIP := baseIPInt + (i * subnetSize)
+	if ca.placementSeed != "" {
+		start = pool.seededStart(ca.placementSeed)
+	}
 
-		// Convert back to an IP and create the CIDR
-		candidateIP := uint32ToIP(startIP)
-		candidateCIDR := fmt.Sprintf("%s/%d", candidateIP.String(), prefixLength)
+	used, err := ca.poolIndex(pool)
+	if err != nil {
+		return nil, err
+	}
 
-		// Parse the candidate CIDR
-		_, candidateNetwork, err := net.ParseCIDR(candidateCIDR)
+	for {
+		cidrs, err := findFreeBlocks(pool, start, prefixLengths, used)
 		if err != nil {
-			continue // Skip if we can't parse it
+			ca.indexes = nil // Blocks found before the failure were marked as used
+			return nil, err
 		}
-
-		// Check if this candidate overlaps with any existing network
-		if !overlapsWithAny(candidateNetwork, existingNetworks) {
-			return candidateCIDR, nil
+		if ca.leaseStore == nil {
+			ca.track(cidrs)
+			return cidrs, nil
+		}
+		failed, err := ca.leaseAll(cidrs)
+		if errors.Is(err, ErrLeaseConflict) {
+			// Another process leased an overlapping block since we listed; rebuild without the blocks we just
+			// released and try the next one
+			ca.indexes = nil
+			if used, err = ca.poolIndex(pool); err != nil {
+				return nil, err
+			}
+			used.insertCidrs(cidrs[failed : failed+1])
+			continue
 		}
+		if err != nil {
+			ca.indexes = nil
+			return nil, err
+		}
+		ca.track(cidrs)
+		return cidrs, nil
 	}
-
-	return "", errors.New("no available CIDR block found within the given base network")
 }
 
-// getAllExistingCIDRs retrieves all CIDR blocks from VPCs and Kubernetes clusters
-func getAllExistingCIDRs(ctx context.Context, client *godo.Client) ([]string, error) {
-	var cidrs []string
-
-	// Get VPC CIDRs
-	vpcCIDRs, err := getVpcCIDRs(ctx, client)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get VPC CIDRs: %w", err)
-	}
-	cidrs = append(cidrs, vpcCIDRs...)
-
-	// Get Kubernetes cluster CIDRs
-	k8sCIDRs, err := getKubernetesCIDRs(ctx, client)
+// poolIndex returns the index of every range in pool that must not be allocated: excluded ranges, blocks already
+// allocated, existing networks and, if a lease store is configured, leased blocks. The index is cached until the
+// inventory is listed again or a range is removed, so only the leases, which other processes change, are listed
+// each time. Leases that have since been released stay in the cached index until then. ca.mu must be held.
+func (ca *CidrAssigner) poolIndex(pool *cidrPool) (*cidrIndex, error) {
+	ca.pruneAllocations()
+	existingRanges, err := ca.cachedInventory()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get Kubernetes CIDRs: %w", err)
+		return nil, err
 	}
-	cidrs = append(cidrs, k8sCIDRs...)
 
-	return cidrs, nil
-}
-
-// getVpcCIDRs retrieves all CIDR blocks from VPCs
-func getVpcCIDRs(ctx context.Context, client *godo.Client) ([]string, error) {
-	var cidrs []string
-	opt := &godo.ListOptions{
-		Page:    1,
-		PerPage: 100,
+	used, ok := ca.indexes[pool.prefix]
+	if !ok {
+		unavailableCidrs := append([]string{}, ca.excludedCidrs...)
+		for _, allocation := range ca.allocations {
+			unavailableCidrs = append(unavailableCidrs, allocation.Cidr)
+		}
+		for _, r := range existingRanges {
+			unavailableCidrs = append(unavailableCidrs, r.Cidr)
+		}
+		used = indexCidrs(pool, unavailableCidrs)
+		if ca.indexes == nil {
+			ca.indexes = make(map[netip.Prefix]*cidrIndex)
+		}
+		ca.indexes[pool.prefix] = used
 	}
 
-	for {
-		vpcs, resp, err := client.VPCs.List(ctx, opt)
+	if ca.leaseStore != nil {
+		leases, err := ca.leaseStore.List(ca.ctx)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to list CIDR leases: %w", err)
 		}
-
-		for _, vpc := range vpcs {
-			cidrs = append(cidrs, vpc.IPRange)
+		for _, lease := range leases {
+			used.insertCidrs([]string{lease.Cidr})
 		}
+	}
+	return used, nil
+}
 
-		// Check if we need to paginate
-		if resp.Links == nil || resp.Links.IsLastPage() {
-			break
+// leaseAll leases every block in cidrs. If any lease fails, the leases already taken are released and
+// the index of the failing block is returned along with the error.
+func (ca *CidrAssigner) leaseAll(cidrs []string) (int, error) {
+	for i, cidr := range cidrs {
+		_, err := ca.leaseStore.Acquire(ca.ctx, cidr, ca.leaseOwner, ca.leaseTTL)
+		if err == nil {
+			continue
 		}
-
-		// Get the next page
-		page, err := resp.Links.CurrentPage()
-		if err != nil {
-			return nil, err
+		for _, leased := range cidrs[:i] {
+			if releaseErr := ca.leaseStore.Release(ca.ctx, leased, ca.leaseOwner); releaseErr != nil {
+				// The lease will still expire after its TTL
+				log.Printf("Failed to release CIDR lease %s: %v", leased, releaseErr)
+			}
 		}
-		opt.Page = page + 1
+		return i, fmt.Errorf("failed to lease CIDR %s: %w", cidr, err)
 	}
+	return 0, nil
+}
 
-	return cidrs, nil
+// track records newly allocated blocks. ca.mu must be held.
+func (ca *CidrAssigner) track(cidrs []string) {
+	var expiresAt time.Time
+	if ca.leaseStore != nil {
+		expiresAt = ca.now().Add(ca.leaseTTL)
+	}
+	for _, cidr := range cidrs {
+		ca.allocations = append(ca.allocations, CidrAllocation{Cidr: cidr, ExpiresAt: expiresAt})
+	}
 }
 
-// getKubernetesCIDRs retrieves all CIDR blocks from Kubernetes clusters
-func getKubernetesCIDRs(ctx context.Context, client *godo.Client) ([]string, error) {
-	var cidrs []string
-	opt := &godo.ListOptions{
-		Page:    1,
-		PerPage: 100,
+// pruneAllocations forgets allocations whose lease has expired, since another process may hold the block now.
+// Allocations made without a lease store are only held in memory, so they are kept until they are released.
+// ca.mu must be held.
+func (ca *CidrAssigner) pruneAllocations() {
+	now := ca.now()
+	active := ca.allocations[:0]
+	for _, allocation := range ca.allocations {
+		if allocation.ExpiresAt.IsZero() || now.Before(allocation.ExpiresAt) {
+			active = append(active, allocation)
+		}
 	}
+	if len(active) < len(ca.allocations) {
+		ca.indexes = nil
+	}
+	ca.allocations = active
+}
 
-	for {
-		clusters, resp, err := client.Kubernetes.List(ctx, opt)
-		if err != nil {
-			return nil, err
+// Allocations returns the blocks this assigner has handed out that have not been released or expired.
+func (ca *CidrAssigner) Allocations() []CidrAllocation {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.pruneAllocations()
+	return append([]CidrAllocation{}, ca.allocations...)
+}
+
+// Release returns cidr to the pool, releasing its lease if a lease store is configured.
+// It returns an error matching ErrCidrNotAllocated if the assigner does not hold cidr.
+func (ca *CidrAssigner) Release(cidr string) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.pruneAllocations()
+	for i, allocation := range ca.allocations {
+		if allocation.Cidr != cidr {
+			continue
+		}
+		ca.allocations = append(ca.allocations[:i], ca.allocations[i+1:]...)
+		ca.indexes = nil // The block may still be used by something else, so rebuild rather than free it
+		if ca.leaseStore == nil {
+			return nil
 		}
+		if err := ca.leaseStore.Release(ca.ctx, cidr, ca.leaseOwner); err != nil && !errors.Is(err, ErrLeaseNotFound) {
+			return fmt.Errorf("failed to release lease for %s: %w", cidr, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCidrNotAllocated, cidr)
+}
 
-		for _, cluster := range clusters {
-			// Add cluster subnet CIDR
-			if cluster.ClusterSubnet != "" {
-				cidrs = append(cidrs, cluster.ClusterSubnet)
+// releaseOnCleanup records t as the owner of cidrs and registers a t.Cleanup that releases them once the test
+// (including any deferred terraform destroy) has finished. If the test failed the blocks are kept, as the
+// networks may still exist; they are freed when their allocation and lease expire.
+func (ca *CidrAssigner) releaseOnCleanup(t testing.TB, cidrs ...string) {
+	ca.mu.Lock()
+	for i := range ca.allocations {
+		for _, cidr := range cidrs {
+			if ca.allocations[i].Cidr == cidr {
+				ca.allocations[i].Test = t.Name()
 			}
+		}
+	}
+	ca.mu.Unlock()
 
-			// Add service subnet CIDR
-			if cluster.ServiceSubnet != "" {
-				cidrs = append(cidrs, cluster.ServiceSubnet)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("Keeping CIDR allocations %v because the test failed", cidrs)
+			return
+		}
+		for _, cidr := range cidrs {
+			if err := ca.Release(cidr); err != nil && !errors.Is(err, ErrCidrNotAllocated) {
+				t.Errorf("Failed to release CIDR %s: %v", cidr, err)
 			}
 		}
+	})
+}
 
-		// Check if we need to paginate
-		if resp.Links == nil || resp.Links.IsLastPage() {
-			break
+// RenewLeases extends the lease of every allocation held by this assigner by the configured lease TTL.
+// Long-running tests should call it periodically to keep their blocks reserved. Without a lease store,
+// allocations never expire and there is nothing to renew.
+func (ca *CidrAssigner) RenewLeases() error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if ca.leaseStore == nil {
+		return nil
+	}
+	ca.pruneAllocations()
+	for i, allocation := range ca.allocations {
+		if _, err := ca.leaseStore.Renew(ca.ctx, allocation.Cidr, ca.leaseOwner, ca.leaseTTL); err != nil {
+			return fmt.Errorf("failed to renew lease for %s: %w", allocation.Cidr, err)
 		}
+		ca.allocations[i].ExpiresAt = ca.now().Add(ca.leaseTTL)
+	}
+	return nil
+}
 
-		// Get the next page
-		page, err := resp.Links.CurrentPage()
+// Prefix length bounds accepted for each address family.
+const (
+	minIPv4PrefixLength = 8
+	maxIPv4PrefixLength = 30
+	minIPv6PrefixLength = 48
+	maxIPv6PrefixLength = 64
+)
+
+// parseBaseNetwork returns the private pool containing baseNetwork and baseNetwork as an address.
+func parseBaseNetwork(baseNetwork string) (*cidrPool, netip.Addr, error) {
+	baseIP, err := netip.ParseAddr(baseNetwork)
+	if err != nil {
+		return nil, netip.Addr{}, fmt.Errorf("invalid base network: %s", baseNetwork)
+	}
+	baseIP = baseIP.Unmap()
+
+	// Find the private pool the base network belongs to
+	pool, err := poolForAddress(baseIP)
+	if err != nil {
+		return nil, netip.Addr{}, fmt.Errorf("invalid base network %s: %w", baseNetwork, err)
+	}
+	return pool, baseIP, nil
+}
+
+// findFreeBlocks finds a free block in pool for each of prefixLengths, avoiding used and each other, and marks
+// the blocks as used.
+func findFreeBlocks(pool *cidrPool, start netip.Addr, prefixLengths []int, used *cidrIndex) ([]string, error) {
+	cidrs := make([]string, 0, len(prefixLengths))
+	for _, prefixLength := range prefixLengths {
+		block, err := pool.findFreeBlock(prefixLength, start, used)
 		if err != nil {
 			return nil, err
 		}
-		opt.Page = page + 1
+		used.insert(block)
+		cidrs = append(cidrs, block.String())
 	}
-
 	return cidrs, nil
 }
 
-// overlapsWithAny checks if the given network overlaps with any of the existing networks
-func overlapsWithAny(candidate *net.IPNet, existingNetworks []*net.IPNet) bool {
-	for _, existing := range existingNetworks {
-		if networksOverlap(candidate, existing) {
-			return true
+// indexCidrs parses cidrs and indexes the ones inside pool.
+func indexCidrs(pool *cidrPool, cidrs []string) *cidrIndex {
+	networks := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		network, err := parsePrefix(cidr)
+		if err != nil {
+			continue // Skip invalid CIDRs
 		}
+		networks = append(networks, network)
 	}
-	return false
-}
-
-// networksOverlap checks if two networks overlap
-func networksOverlap(n1, n2 *net.IPNet) bool {
-	// Check if either network contains the other's IP
-	return n1.Contains(n2.IP) || n2.Contains(n1.IP)
+	return newCidrIndex(pool, networks)
 }
 
-// ipToUint32 converts an IP address to a uint32
-func ipToUint32(ip net.IP) uint32 {
-	ip = ip.To4()
-	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+// insertCidrs parses cidrs and marks the ones inside the index's pool as used.
+func (x *cidrIndex) insertCidrs(cidrs []string) {
+	for _, cidr := range cidrs {
+		network, err := parsePrefix(cidr)
+		if err != nil {
+			continue // Skip invalid CIDRs
+		}
+		x.insert(network)
+	}
 }
 
-// uint32ToIP converts a uint32 to an IP address
-func uint32ToIP(n uint32) net.IP {
-	ip := make(net.IP, 4)
-	ip[0] = byte(n >> 24)
-	ip[1] = byte(n >> 16)
-	ip[2] = byte(n >> 8)
-	ip[3] = byte(n)
-	return ip
+// networksOverlap checks if two networks overlap
+func networksOverlap(n1, n2 netip.Prefix) bool {
+	return n1.Overlaps(n2)
 }
@@ -2,185 +2,25 @@ package helper
 
 import (
 	"context"
-	"net"
+	"net/netip"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice/doservicefakes"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-// MockVPCsService implements a minimal mock of the VPCsService interface for testing
-type MockVPCsService struct {
-	vpcs []*godo.VPC
-	err  error
-}
-
-func (m *MockVPCsService) List(ctx context.Context, listOpt *godo.ListOptions) ([]*godo.VPC, *godo.Response, error) {
-	if m.err != nil {
-		return nil, nil, m.err
-	}
-
-	resp := &godo.Response{
-		Links: &godo.Links{},
-	}
-
-	return m.vpcs, resp, nil
-}
-
-// Unused methods required by the interface
-func (m *MockVPCsService) Get(context.Context, string) (*godo.VPC, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) Create(context.Context, *godo.VPCCreateRequest) (*godo.VPC, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) Update(context.Context, string, *godo.VPCUpdateRequest) (*godo.VPC, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) Set(context.Context, string, ...godo.VPCSetField) (*godo.VPC, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) Delete(context.Context, string) (*godo.Response, error) {
-	return nil, nil
-}
-
-func (m *MockVPCsService) ListMembers(context.Context, string, *godo.VPCListMembersRequest, *godo.ListOptions) ([]*godo.VPCMember, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) CreateVPCPeering(context.Context, *godo.VPCPeeringCreateRequest) (*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) GetVPCPeering(context.Context, string) (*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) ListVPCPeerings(context.Context, *godo.ListOptions) ([]*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) UpdateVPCPeering(context.Context, string, *godo.VPCPeeringUpdateRequest) (*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) DeleteVPCPeering(context.Context, string) (*godo.Response, error) {
-	return nil, nil
-}
-
-func (m *MockVPCsService) CreateVPCPeeringByVPCID(context.Context, string, *godo.VPCPeeringCreateRequestByVPCID) (*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) ListVPCPeeringsByVPCID(context.Context, string, *godo.ListOptions) ([]*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-func (m *MockVPCsService) UpdateVPCPeeringByVPCID(context.Context, string, string, *godo.VPCPeeringUpdateRequest) (*godo.VPCPeering, *godo.Response, error) {
-	return nil, nil, nil
-}
-
-// MockKubernetesService implements a minimal mock of the KubernetesService interface for testing
-type MockKubernetesService struct {
-	clusters []*godo.KubernetesCluster
-	err      error
-}
-
-func (m *MockKubernetesService) List(ctx context.Context, opts *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error) {
-	if m.err != nil {
-		return nil, nil, m.err
-	}
-	resp := &godo.Response{
-		Links: &godo.Links{},
-	}
-	return m.clusters, resp, nil
-}
-
-// Unused methods required by the interface
-func (m *MockKubernetesService) Create(context.Context, *godo.KubernetesClusterCreateRequest) (*godo.KubernetesCluster, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) Get(context.Context, string) (*godo.KubernetesCluster, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetUser(context.Context, string) (*godo.KubernetesClusterUser, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetUpgrades(context.Context, string) ([]*godo.KubernetesVersion, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetKubeConfig(context.Context, string) (*godo.KubernetesClusterConfig, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetKubeConfigWithExpiry(context.Context, string, int64) (*godo.KubernetesClusterConfig, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetCredentials(context.Context, string, *godo.KubernetesClusterCredentialsGetRequest) (*godo.KubernetesClusterCredentials, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) Update(context.Context, string, *godo.KubernetesClusterUpdateRequest) (*godo.KubernetesCluster, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) Upgrade(context.Context, string, *godo.KubernetesClusterUpgradeRequest) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) Delete(context.Context, string) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) DeleteSelective(context.Context, string, *godo.KubernetesClusterDeleteSelectiveRequest) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) DeleteDangerous(context.Context, string) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) ListAssociatedResourcesForDeletion(context.Context, string) (*godo.KubernetesAssociatedResources, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) CreateNodePool(ctx context.Context, clusterID string, req *godo.KubernetesNodePoolCreateRequest) (*godo.KubernetesNodePool, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetNodePool(ctx context.Context, clusterID, poolID string) (*godo.KubernetesNodePool, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetNodePoolTemplate(ctx context.Context, clusterID string, nodePoolName string) (*godo.KubernetesNodePoolTemplate, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) ListNodePools(ctx context.Context, clusterID string, opts *godo.ListOptions) ([]*godo.KubernetesNodePool, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) UpdateNodePool(ctx context.Context, clusterID, poolID string, req *godo.KubernetesNodePoolUpdateRequest) (*godo.KubernetesNodePool, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) RecycleNodePoolNodes(ctx context.Context, clusterID, poolID string, req *godo.KubernetesNodePoolRecycleNodesRequest) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) DeleteNodePool(ctx context.Context, clusterID, poolID string) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) DeleteNode(ctx context.Context, clusterID, poolID, nodeID string, req *godo.KubernetesNodeDeleteRequest) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) GetOptions(context.Context) (*godo.KubernetesOptions, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) AddRegistry(ctx context.Context, req *godo.KubernetesClusterRegistryRequest) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) RemoveRegistry(ctx context.Context, req *godo.KubernetesClusterRegistryRequest) (*godo.Response, error) {
-	return nil, nil
-}
-func (m *MockKubernetesService) RunClusterlint(ctx context.Context, clusterID string, req *godo.KubernetesRunClusterlintRequest) (string, *godo.Response, error) {
-	return "", nil, nil
-}
-func (m *MockKubernetesService) GetClusterlintResults(ctx context.Context, clusterID string, req *godo.KubernetesGetClusterlintRequest) ([]*godo.ClusterlintDiagnostic, *godo.Response, error) {
-	return nil, nil, nil
-}
-func (m *MockKubernetesService) GetClusterStatusMessages(ctx context.Context, clusterID string, req *godo.KubernetesGetClusterStatusMessagesRequest) ([]*godo.KubernetesClusterStatusMessage, *godo.Response, error) {
-	return nil, nil, nil
+// fakeCidrSources returns the default sources, backed by fakes listing vpcs and clusters
+func fakeCidrSources(vpcs []*godo.VPC, clusters []*godo.KubernetesCluster) []CidrSource {
+	vpcLister := &doservicefakes.FakeVpcLister{}
+	vpcLister.ListReturns(vpcs, &godo.Response{Links: &godo.Links{}}, nil)
+	clusterLister := &doservicefakes.FakeKubernetesClusterLister{}
+	clusterLister.ListReturns(clusters, &godo.Response{Links: &godo.Links{}}, nil)
+	return []CidrSource{NewVpcCidrSource(vpcLister), NewDoksClusterCidrSource(clusterLister)}
 }
 
 func TestCidrAssigner_GetCidrBlock(t *testing.T) {
@@ -251,16 +91,48 @@ func TestCidrAssigner_GetCidrBlock(t *testing.T) {
 			expectError:    false,
 		},
 		{
-			name:         "Support multiple existing 192.168.0.0 networks with different prefix lengths",
+			name:         "Never leave the 192.168.0.0/16 private block",
 			baseNetwork:  "192.168.0.0",
 			prefixLength: 16,
 			existingVPCs: []*godo.VPC{
 				{IPRange: "192.168.0.0/16"},
-				{IPRange: "192.169.1.0/24"},
-				{IPRange: "192.170.0.0/17"},
+			},
+			existingK8s: []*godo.KubernetesCluster{},
+			expectError: true,
+		},
+		{
+			name:         "Support multiple existing 192.168.0.0 networks with different prefix lengths",
+			baseNetwork:  "192.168.0.0",
+			prefixLength: 24,
+			existingVPCs: []*godo.VPC{
+				{IPRange: "192.168.0.0/24"},
+				{IPRange: "192.168.1.0/25"},
+				{IPRange: "192.168.2.0/23"},
 			},
 			existingK8s:    []*godo.KubernetesCluster{},
-			expectedPrefix: "192.171.0.0/16",
+			expectedPrefix: "192.168.4.0/24",
+			expectError:    false,
+		},
+		{
+			name:         "Search beyond the first 256 candidate subnets",
+			baseNetwork:  "10.0.0.0",
+			prefixLength: 24,
+			existingVPCs: []*godo.VPC{
+				{IPRange: "10.0.0.0/16"},
+			},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectedPrefix: "10.1.0.0/24",
+			expectError:    false,
+		},
+		{
+			name:         "Wrap around to the start of the pool",
+			baseNetwork:  "10.255.255.0",
+			prefixLength: 24,
+			existingVPCs: []*godo.VPC{
+				{IPRange: "10.255.255.0/24"},
+			},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectedPrefix: "10.0.0.0/24",
 			expectError:    false,
 		},
 		{
@@ -289,6 +161,76 @@ func TestCidrAssigner_GetCidrBlock(t *testing.T) {
 			expectedPrefix: "10.0.3.0/24",
 			expectError:    false,
 		},
+		{
+			name:           "IPv6 ULA with no existing networks",
+			baseNetwork:    "fd00::",
+			prefixLength:   64,
+			existingVPCs:   []*godo.VPC{},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectedPrefix: "fd00::/64",
+			expectError:    false,
+		},
+		{
+			name:         "IPv6 ULA with existing /64 networks",
+			baseNetwork:  "fd00::",
+			prefixLength: 64,
+			existingVPCs: []*godo.VPC{
+				{IPRange: "fd00::/64"},
+				{IPRange: "fd00:0:0:1::/64"},
+			},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectedPrefix: "fd00:0:0:2::/64",
+			expectError:    false,
+		},
+		{
+			name:         "IPv6 /48 skips an overlapping /56",
+			baseNetwork:  "fd12:3456:789a::",
+			prefixLength: 48,
+			existingVPCs: []*godo.VPC{
+				{IPRange: "fd12:3456:789a:100::/56"},
+			},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectedPrefix: "fd12:3456:789b::/48",
+			expectError:    false,
+		},
+		{
+			name:         "IPv6 ignores existing IPv4 networks",
+			baseNetwork:  "fd00::",
+			prefixLength: 56,
+			existingVPCs: []*godo.VPC{
+				{IPRange: "10.0.0.0/8"},
+			},
+			existingK8s: []*godo.KubernetesCluster{
+				{ClusterSubnet: "fd00::/60", ServiceSubnet: "fd00:0:0:100::/64"},
+			},
+			expectedPrefix: "fd00:0:0:200::/56",
+			expectError:    false,
+		},
+		{
+			name:           "IPv4 ignores existing IPv6 networks",
+			baseNetwork:    "10.0.0.0",
+			prefixLength:   24,
+			existingVPCs:   []*godo.VPC{{IPRange: "fd00::/8"}},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectedPrefix: "10.0.0.0/24",
+			expectError:    false,
+		},
+		{
+			name:           "Invalid IPv6 prefix length",
+			baseNetwork:    "fd00::",
+			prefixLength:   24,
+			existingVPCs:   []*godo.VPC{},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectError:    true,
+		},
+		{
+			name:           "Reject global unicast IPv6 address",
+			baseNetwork:    "2001:db8::",
+			prefixLength:   64,
+			existingVPCs:   []*godo.VPC{},
+			existingK8s:    []*godo.KubernetesCluster{},
+			expectError:    true,
+		},
 		{
 			name:           "Not an IP address",
 			baseNetwork:    "invalid-ip",
@@ -325,20 +267,7 @@ func TestCidrAssigner_GetCidrBlock(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a mock client
-			client := &godo.Client{}
-
-			// Set up mock VPC service
-			client.VPCs = &MockVPCsService{
-				vpcs: tt.existingVPCs,
-			}
-
-			// Set up mock Kubernetes service
-			client.Kubernetes = &MockKubernetesService{
-				clusters: tt.existingK8s,
-			}
-
-			assigner := NewCidrAssigner(context.Background(), client)
+			assigner := NewCidrAssigner(context.Background(), nil, fakeCidrSources(tt.existingVPCs, tt.existingK8s)...)
 
 			// Call the function
 			cidr, err := assigner.GetCidrBlock(tt.baseNetwork, tt.prefixLength)
@@ -351,15 +280,392 @@ func TestCidrAssigner_GetCidrBlock(t *testing.T) {
 				assert.Equal(t, tt.expectedPrefix, cidr)
 
 				// Validate that the returned CIDR is valid
-				_, _, err := net.ParseCIDR(cidr)
+				_, err := netip.ParsePrefix(cidr)
 				assert.NoError(t, err, "Returned CIDR should be valid")
 			}
 		})
 	}
 }
 
-// TestOverlapsWithAny tests the overlapsWithAny function
-func TestOverlapsWithAny(t *testing.T) {
+func TestCidrAssigner_GetCidrBlockFromPool(t *testing.T) {
+	tests := []struct {
+		name           string
+		pool           string
+		prefixLength   int
+		existingVPCs   []*godo.VPC
+		expectedPrefix string
+		expectedError  string
+	}{
+		{
+			name:           "Lowest free block in 172.16.0.0/12",
+			pool:           "172.16.0.0/12",
+			prefixLength:   20,
+			existingVPCs:   []*godo.VPC{{IPRange: "172.16.0.0/24"}, {IPRange: "10.0.0.0/8"}},
+			expectedPrefix: "172.16.16.0/20",
+		},
+		{
+			name:           "Ignore networks outside the pool",
+			pool:           "10.20.0.0/16",
+			prefixLength:   24,
+			existingVPCs:   []*godo.VPC{{IPRange: "10.0.0.0/16"}, {IPRange: "10.21.0.0/16"}},
+			expectedPrefix: "10.20.0.0/24",
+		},
+		{
+			name:           "Use a gap between existing networks",
+			pool:           "10.20.0.0/16",
+			prefixLength:   23,
+			existingVPCs:   []*godo.VPC{{IPRange: "10.20.0.0/24"}, {IPRange: "10.20.2.0/23"}, {IPRange: "10.20.5.0/24"}},
+			expectedPrefix: "10.20.6.0/23",
+		},
+		{
+			name:          "Report fragmentation when exhausted",
+			pool:          "10.20.0.0/22",
+			prefixLength:  23,
+			existingVPCs:  []*godo.VPC{{IPRange: "10.20.1.0/24"}, {IPRange: "10.20.2.0/25"}},
+			expectedError: "no free /23 block in 10.20.0.0/22: 640 addresses free across 2 fragments, largest free block is a /24",
+		},
+		{
+			name:          "Report a fully allocated pool",
+			pool:          "10.20.0.0/22",
+			prefixLength:  24,
+			existingVPCs:  []*godo.VPC{{IPRange: "10.20.0.0/16"}},
+			expectedError: "no free /24 block in 10.20.0.0/22: pool is fully allocated",
+		},
+		{
+			name:          "Reject a pool that is not private",
+			pool:          "10.0.0.0/7",
+			prefixLength:  24,
+			expectedError: "CIDR pool 10.0.0.0/7 is not entirely private (RFC1918 or unique local) address space",
+		},
+		{
+			name:          "Reject a block larger than the pool",
+			pool:          "10.20.0.0/24",
+			prefixLength:  16,
+			expectedError: "prefix length /16 is larger than the pool 10.20.0.0/24",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assigner := NewCidrAssigner(context.Background(), nil, fakeCidrSources(tt.existingVPCs, nil)...)
+
+			cidr, err := assigner.GetCidrBlockFromPool(tt.pool, tt.prefixLength)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedPrefix, cidr)
+		})
+	}
+}
+
+func TestCidrAssigner_GetCidrBlockFromPoolExhaustedError(t *testing.T) {
+	assigner := NewCidrAssigner(context.Background(), nil, fakeCidrSources([]*godo.VPC{{IPRange: "10.20.0.0/24"}}, nil)...)
+
+	_, err := assigner.GetCidrBlockFromPool("10.20.0.0/23", 23)
+	assert.ErrorIs(t, err, ErrCidrPoolExhausted)
+
+	var exhausted *CidrPoolExhaustedError
+	if assert.ErrorAs(t, err, &exhausted) {
+		assert.Equal(t, "256", exhausted.FreeAddresses.String())
+		assert.Equal(t, 1, exhausted.FreeFragments)
+		assert.Equal(t, 24, exhausted.LargestFreePrefix)
+	}
+}
+
+func TestCidrAssigner_Exclusions(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           *CidrAssignerOptions
+		exclude        []string
+		pool           string
+		prefixLength   int
+		expectedPrefix string
+	}{
+		{
+			name:           "Skip DigitalOcean reserved ranges by default",
+			pool:           "10.244.0.0/14",
+			prefixLength:   16,
+			expectedPrefix: "10.247.0.0/16",
+		},
+		{
+			name:           "Allow reserved ranges when ignored",
+			opts:           &CidrAssignerOptions{IgnoreReservedCidrs: true},
+			pool:           "10.244.0.0/14",
+			prefixLength:   16,
+			expectedPrefix: "10.244.0.0/16",
+		},
+		{
+			name:           "Skip extra exclusions from options",
+			opts:           &CidrAssignerOptions{ExcludedCidrs: []string{"172.16.0.0/16"}},
+			pool:           "172.16.0.0/12",
+			prefixLength:   16,
+			expectedPrefix: "172.18.0.0/16",
+		},
+		{
+			name:           "Skip extra exclusions added later",
+			exclude:        []string{"192.168.0.0/17"},
+			pool:           "192.168.0.0/16",
+			prefixLength:   24,
+			expectedPrefix: "192.168.128.0/24",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := CidrAssignerOptions{}
+			if tt.opts != nil {
+				opts = *tt.opts
+			}
+			opts.Sources = fakeCidrSources(nil, nil)
+			assigner := NewCidrAssignerWithOptions(context.Background(), nil, &opts)
+			assigner.Exclude(tt.exclude...)
+
+			cidr, err := assigner.GetCidrBlockFromPool(tt.pool, tt.prefixLength)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedPrefix, cidr)
+		})
+	}
+}
+
+func TestCidrAssigner_PlacementSeed(t *testing.T) {
+	newAssigner := func(seed string, existing ...string) *CidrAssigner {
+		return NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+			Sources:       []CidrSource{NewStaticCidrSource("existing", existing...)},
+			PlacementSeed: seed,
+		})
+	}
+
+	// The same seed lands on the same block, a different seed elsewhere
+	cidr, err := newAssigner("TestFoo").GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, "10.203.151.0/24", cidr)
+	cidr, err = newAssigner("TestFoo").GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, "10.203.151.0/24", cidr)
+	cidr, err = newAssigner("TestBar").GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, "10.217.100.0/24", cidr)
+
+	// The seed replaces the base network as the start of the search
+	cidr, err = newAssigner("TestFoo").GetCidrBlock("192.168.0.0", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.151.0/24", cidr)
+
+	// "TestFoo" starts at 192.168.2.175 in 192.168.0.0/22, so the search wraps around when 192.168.3.0/24 is taken
+	cidr, err = newAssigner("TestFoo").GetCidrBlockFromPool("192.168.0.0/22", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.3.0/24", cidr)
+	cidr, err = newAssigner("TestFoo", "192.168.3.0/24").GetCidrBlockFromPool("192.168.0.0/22", 24)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.0.0/24", cidr)
+}
+
+func TestCidrAssigner_InventoryCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &countingCidrSource{CidrSource: NewStaticCidrSource("existing", "10.0.0.0/24")}
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:      []CidrSource{source},
+		InventoryTTL: time.Minute,
+	})
+	assigner.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := assigner.GetVpcCidrE()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, source.calls, "allocations within the TTL should reuse the inventory")
+
+	require.NoError(t, assigner.Refresh())
+	assert.Equal(t, 2, source.calls, "Refresh should always list the sources")
+
+	now = now.Add(time.Minute)
+	inventory, err := assigner.Inventory()
+	require.NoError(t, err)
+	assert.Equal(t, 3, source.calls, "an expired inventory should be listed again")
+	assert.Equal(t, []CidrRange{{Cidr: "10.0.0.0/24", Owner: "existing", Source: "existing"}}, inventory)
+}
+
+func TestCidrAssigner_InventoryCacheDisabled(t *testing.T) {
+	source := &countingCidrSource{CidrSource: NewStaticCidrSource("existing")}
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:      []CidrSource{source},
+		InventoryTTL: -1,
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := assigner.GetVpcCidrE()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, source.calls)
+}
+
+func TestCidrAssigner_ConcurrentUse(t *testing.T) {
+	assigner := NewCidrAssigner(context.Background(), nil, NewStaticCidrSource("existing", "10.0.0.0/24"))
+
+	const workers = 20
+	cidrs := make(chan string, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cidr, err := assigner.GetVpcCidrE()
+			assert.NoError(t, err)
+			cidrs <- cidr
+		}()
+	}
+	wg.Wait()
+	close(cidrs)
+
+	seen := map[string]bool{}
+	for cidr := range cidrs {
+		assert.False(t, seen[cidr], "CIDR %s allocated twice", cidr)
+		seen[cidr] = true
+	}
+	assert.Len(t, seen, workers)
+}
+
+// cleanupRecorder is a testing.TB that records cleanups so they can be run with the test passing or failing
+type cleanupRecorder struct {
+	testing.TB
+	name     string
+	failed   bool
+	cleanups []func()
+}
+
+func (r *cleanupRecorder) Name() string                  { return r.name }
+func (r *cleanupRecorder) Failed() bool                  { return r.failed }
+func (r *cleanupRecorder) Helper()                       {}
+func (r *cleanupRecorder) Logf(string, ...interface{})   {}
+func (r *cleanupRecorder) Cleanup(f func())              { r.cleanups = append(r.cleanups, f) }
+func (r *cleanupRecorder) Errorf(string, ...interface{}) { r.failed = true }
+
+func (r *cleanupRecorder) runCleanups() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestCidrAssigner_Release(t *testing.T) {
+	store := NewFileCidrLeaseStore(filepath.Join(t.TempDir(), "leases.json"))
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:    []CidrSource{NewStaticCidrSource("existing")},
+		LeaseStore: store,
+	})
+
+	first, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+	second, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+
+	require.NoError(t, assigner.Release(first))
+	allocations := assigner.Allocations()
+	require.Len(t, allocations, 1)
+	assert.Equal(t, second, allocations[0].Cidr)
+	leases, err := store.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.Equal(t, second, leases[0].Cidr)
+
+	// The released block is handed out again
+	cidr, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, first, cidr)
+
+	assert.ErrorIs(t, assigner.Release("10.99.0.0/24"), ErrCidrNotAllocated)
+}
+
+func TestCidrAssigner_AllocationsExpire(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewFileCidrLeaseStore(filepath.Join(t.TempDir(), "leases.json"))
+	store.now = func() time.Time { return now }
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:    []CidrSource{NewStaticCidrSource("existing")},
+		LeaseStore: store,
+		LeaseTTL:   time.Hour,
+	})
+	assigner.now = func() time.Time { return now }
+
+	first, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	second, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+
+	// Only the first allocation has expired
+	now = now.Add(45 * time.Minute)
+	assert.Equal(t, []CidrAllocation{{Cidr: second, ExpiresAt: now.Add(15 * time.Minute)}}, assigner.Allocations())
+
+	// Renewing pushes the expiry back
+	require.NoError(t, assigner.RenewLeases())
+	now = now.Add(59 * time.Minute)
+	assert.Len(t, assigner.Allocations(), 1)
+
+	cidr, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+	assert.Equal(t, first, cidr)
+}
+
+func TestCidrAssigner_AllocationsWithoutLeaseStoreDoNotExpire(t *testing.T) {
+	// The environment's lease store is only used when it is passed in
+	leaseFile := filepath.Join(t.TempDir(), "leases.json")
+	t.Setenv("CIDR_LEASE_URL", "")
+	t.Setenv("CIDR_LEASE_FILE", leaseFile)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	assigner := NewCidrAssignerWithOptions(context.Background(), nil, &CidrAssignerOptions{
+		Sources:  []CidrSource{NewStaticCidrSource("existing")},
+		LeaseTTL: time.Hour,
+	})
+	assigner.now = func() time.Time { return now }
+
+	first, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+
+	// A long single-process suite must never be handed a block its own earlier stage still uses
+	now = now.Add(24 * time.Hour)
+	assert.Equal(t, []CidrAllocation{{Cidr: first}}, assigner.Allocations())
+	require.NoError(t, assigner.RenewLeases())
+	second, err := assigner.GetVpcCidrE()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.NoFileExists(t, leaseFile)
+}
+
+func TestCidrAssigner_ReleaseOnCleanup(t *testing.T) {
+	tests := []struct {
+		name         string
+		failed       bool
+		expectedLeft int
+	}{
+		{name: "Release after a passing test", failed: false, expectedLeft: 0},
+		{name: "Keep after a failing test", failed: true, expectedLeft: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assigner := NewCidrAssigner(context.Background(), nil, NewStaticCidrSource("existing"))
+			recorder := &cleanupRecorder{TB: t, name: "TestApplyAndDestroy"}
+
+			network := assigner.GetDoksNetworkProfileT(recorder)
+			for _, allocation := range assigner.Allocations() {
+				assert.Equal(t, "TestApplyAndDestroy", allocation.Test)
+			}
+
+			// A block released by the test itself is skipped during cleanup
+			require.NoError(t, assigner.Release(network.ServiceCidr))
+			recorder.failed = tt.failed
+			recorder.runCleanups()
+
+			assert.Equal(t, tt.failed, recorder.failed, "cleanup should not report errors")
+			assert.Len(t, assigner.Allocations(), tt.expectedLeft)
+		})
+	}
+}
+
+// TestCidrIndexOverlaps tests overlap lookups in a cidrIndex
+func TestCidrIndexOverlaps(t *testing.T) {
 	tests := []struct {
 		name      string
 		candidate string
@@ -394,20 +700,15 @@ func TestOverlapsWithAny(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Parse the candidate CIDR
-			_, candidateNet, err := net.ParseCIDR(tt.candidate)
-			assert.NoError(t, err)
-
 			// Parse the existing CIDRs
-			existingNets := make([]*net.IPNet, 0, len(tt.existing))
+			existingNets := make([]netip.Prefix, 0, len(tt.existing))
 			for _, cidr := range tt.existing {
-				_, network, err := net.ParseCIDR(cidr)
-				assert.NoError(t, err)
-				existingNets = append(existingNets, network)
+				existingNets = append(existingNets, netip.MustParsePrefix(cidr))
 			}
 
 			// Check for overlap
-			result := overlapsWithAny(candidateNet, existingNets)
+			pool := newCidrPool(netip.MustParsePrefix("10.0.0.0/8"))
+			result := newCidrIndex(pool, existingNets).overlaps(netip.MustParsePrefix(tt.candidate))
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -449,14 +750,8 @@ func TestNetworksOverlap(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Parse the networks
-			_, net1, err := net.ParseCIDR(tt.network1)
-			assert.NoError(t, err)
-			_, net2, err := net.ParseCIDR(tt.network2)
-			assert.NoError(t, err)
-
 			// Check for overlap
-			result := networksOverlap(net1, net2)
+			result := networksOverlap(netip.MustParsePrefix(tt.network1), netip.MustParsePrefix(tt.network2))
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -1,17 +1,225 @@
 package helper
 
 import (
-	"github.com/digitalocean/godo"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/cassette"
+	"golang.org/x/oauth2"
 )
 
-// CreateGodoClient reads $DIGITALOCEAN_ACCESS_TOKEN and returns a godo.Client or panics.
+const (
+	// DefaultGodoUserAgent identifies requests from the test suite in DigitalOcean API logs.
+	DefaultGodoUserAgent = "scale-with-simplicity-test"
+	// DefaultGodoMaxRetries is how many times a request failing with a 429, 5xx or network error is retried.
+	DefaultGodoMaxRetries = 5
+	// DefaultGodoMinBackoff is the wait before the first retry; it doubles with each retry.
+	DefaultGodoMinBackoff = time.Second
+	// DefaultGodoMaxBackoff caps the wait between retries, except when the API asks for longer.
+	DefaultGodoMaxBackoff = 30 * time.Second
+)
+
+// GodoClientOptions configures the behavior of CreateGodoClientWithOptionsE
+type GodoClientOptions struct {
+	Token           string            // API token (default: resolved by ResolveGodoCredentialE)
+	Context         string            // Named credentials, e.g. DefaultDnsGodoContext (default: $DIGITALOCEAN_CONTEXT, or doctl's current context)
+	DoctlConfigPath string            // doctl config holding auth contexts (default: doctl's, e.g. ~/.config/doctl/config.yaml)
+	TokenFile       string            // File holding the API token, tried last (default: $DIGITALOCEAN_ACCESS_TOKEN_FILE)
+	BaseURL         string            // API endpoint, e.g. a fakedo.Server's URL (default: $DIGITALOCEAN_API_URL, or the public API)
+	UserAgent       string            // Prefixed to godo's User-Agent (default: DefaultGodoUserAgent)
+	MaxRetries      int               // Retries after a 429, 5xx or network error (default: DefaultGodoMaxRetries; negative disables retries)
+	MinBackoff      time.Duration     // Wait before the first retry (default: DefaultGodoMinBackoff)
+	MaxBackoff      time.Duration     // Longest wait between retries (default: DefaultGodoMaxBackoff)
+	Transport       http.RoundTripper // Transport requests are sent with (default: http.DefaultTransport)
+	AuditLog        string            // JSONL file recording every create, update and delete call (default: $DIGITALOCEAN_AUDIT_LOG; unset disables it)
+	TestName        string            // Test the audit log attributes calls to (default: the test given to the T variants, or the program name)
+}
+
+// GodoClients holds a client for the resources under test and one for DNS in the root test domain,
+// which may belong to another team's account. Both are the same client when no separate DNS credentials exist.
+type GodoClients struct {
+	Compute *godo.Client
+	DNS     *godo.Client
+}
+
+// CreateGodoClientE returns a godo.Client using the credentials ResolveGodoCredentialE finds, or an error if
+// there are none. The client retries transient failures as described in CreateGodoClientWithOptionsE.
+func CreateGodoClientE() (*godo.Client, error) {
+	return CreateGodoClientWithOptionsE(nil)
+}
+
+// CreateGodoClientWithOptionsE returns a godo.Client configured by opts, which may be nil.
+// When opts.AuditLog or $DIGITALOCEAN_AUDIT_LOG names a file, an AuditRecord is appended to it for every call
+// that creates, updates or deletes a resource, so leaked resources can be traced to the test that made them.
+// Requests failing with 429 or 5xx responses are retried with exponential backoff and jitter, and network
+// errors are retried for idempotent requests. A POST or PATCH is only retried after a 429 or a failed
+// connection, since after a 5xx the write may already have happened. A 429 is retried no earlier than the RateLimit-Reset header
+// allows, and once RateLimit-Remaining reaches zero further requests wait for the reset.
+func CreateGodoClientWithOptionsE(opts *GodoClientOptions) (*godo.Client, error) {
+	if opts == nil {
+		opts = &GodoClientOptions{}
+	}
+	credential, err := ResolveGodoCredentialE(opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create godo client: %w", err)
+	}
+	if opts.Token == "" {
+		log.Printf("Using DigitalOcean credentials from %s", credential.Source)
+	}
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = os.Getenv("DIGITALOCEAN_API_URL")
+	}
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultGodoUserAgent
+	}
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultGodoMaxRetries
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+	minBackoff := opts.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultGodoMinBackoff
+	}
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultGodoMaxBackoff
+	}
+	auditLog := opts.AuditLog
+	if auditLog == "" {
+		auditLog = os.Getenv("DIGITALOCEAN_AUDIT_LOG")
+	}
+
+	// Retries happen below the oauth2 transport so every attempt is authenticated
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: credential.Token})
+	var transport http.RoundTripper = &oauth2.Transport{
+		Source: tokenSource,
+		Base:   newRetryTransport(opts.Transport, maxRetries, minBackoff, maxBackoff),
+	}
+	if auditLog != "" {
+		// Audited above the retries, so a call is recorded once with its final status
+		testName := opts.TestName
+		if testName == "" {
+			testName = filepath.Base(os.Args[0])
+		}
+		transport = newAuditTransport(transport, auditLog, testName)
+	}
+	httpClient := &http.Client{Transport: transport}
+	clientOpts := []godo.ClientOpt{godo.SetUserAgent(userAgent)}
+	if baseURL != "" {
+		// godo resolves some paths relative to the base URL, so it must end in a slash
+		clientOpts = append(clientOpts, godo.SetBaseURL(strings.TrimSuffix(baseURL, "/")+"/"))
+	}
+	client, err := godo.New(httpClient, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create godo client: %w", err)
+	}
+	return client, nil
+}
+
+// CreateGodoClientsE returns a client for compute resources configured by opts, which may be nil, and a client for DNS
+// using the credentials of the DefaultDnsGodoContext context (or $DIGITALOCEAN_DNS_CONTEXT, if set). When that
+// context has no credentials, DNS uses the compute client. opts.Token and opts.TokenFile are compute credentials,
+// so they are not used for DNS.
+func CreateGodoClientsE(opts *GodoClientOptions) (*GodoClients, error) {
+	compute, err := CreateGodoClientWithOptionsE(opts)
+	if err != nil {
+		return nil, err
+	}
+	dnsOpts := GodoClientOptions{}
+	if opts != nil {
+		dnsOpts = *opts
+	}
+	dnsOpts.Context = os.Getenv("DIGITALOCEAN_DNS_CONTEXT")
+	if dnsOpts.Context == "" {
+		dnsOpts.Context = DefaultDnsGodoContext
+	}
+	dnsOpts.Token = ""
+	dnsOpts.TokenFile = ""
+	dns, err := CreateGodoClientWithOptionsE(&dnsOpts)
+	if errors.Is(err, ErrNoGodoCredentials) {
+		return &GodoClients{Compute: compute, DNS: compute}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &GodoClients{Compute: compute, DNS: dns}, nil
+}
+
+// CreateGodoClientsT is like CreateGodoClientsE but fails the test instead of returning an error.
+func CreateGodoClientsT(t testing.TB, opts *GodoClientOptions) *GodoClients {
+	t.Helper()
+	clients, err := CreateGodoClientsE(withTestName(t, opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clients
+}
+
+// CreateGodoClientT is like CreateGodoClientE but fails the test instead of returning an error.
+func CreateGodoClientT(t testing.TB) *godo.Client {
+	t.Helper()
+	client, err := CreateGodoClientWithOptionsE(withTestName(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// CreateGodoClientWithOptionsT is like CreateGodoClientWithOptionsE but fails the test instead of returning an error.
+func CreateGodoClientWithOptionsT(t testing.TB, opts *GodoClientOptions) *godo.Client {
+	t.Helper()
+	client, err := CreateGodoClientWithOptionsE(withTestName(t, opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// CreateGodoClientWithCassetteT returns a godo.Client that records its traffic to, or replays it from, the
+// cassette at path (conventionally testdata/cassettes/<TestName>.json). A missing cassette is recorded using
+// $DIGITALOCEAN_ACCESS_TOKEN and saved when the test passes; an existing one is replayed without network
+// access or a token. Set $CASSETTE_MODE to record or replay to force either.
+func CreateGodoClientWithCassetteT(t testing.TB, path string) *godo.Client {
+	t.Helper()
+	recorder := cassette.NewRecorderT(t, path, nil)
+	opts := &GodoClientOptions{Transport: recorder}
+	if recorder.Mode() == cassette.ModeReplay {
+		// Replayed responses are never transient, and the token is never sent anywhere
+		opts.Token = "cassette-replay"
+		opts.MaxRetries = -1
+	}
+	return CreateGodoClientWithOptionsT(t, opts)
+}
+
+// withTestName returns a copy of opts, which may be nil, attributing audited calls to t unless it names a test.
+func withTestName(t testing.TB, opts *GodoClientOptions) *GodoClientOptions {
+	named := GodoClientOptions{}
+	if opts != nil {
+		named = *opts
+	}
+	if named.TestName == "" {
+		named.TestName = t.Name()
+	}
+	return &named
+}
+
+// CreateGodoClient is like CreateGodoClientE but panics on error.
 func CreateGodoClient() *godo.Client {
-	accessToken, ok := os.LookupEnv("DIGITALOCEAN_ACCESS_TOKEN")
-	if ok {
-		return godo.NewFromToken(accessToken)
+	client, err := CreateGodoClientE()
+	if err != nil {
+		log.Panicln(err)
 	}
-	log.Panicln("Unable to create godo client as DIGITALOCEAN_ACCESS_TOKEN Env Var is not set. ")
-	return nil
+	return client
 }
@@ -0,0 +1,212 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/cassette"
+	"github.com/digitalocean/scale-with-simplicity/test/fakedo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redirectTransport sends every request to a test server instead of the real API
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newFakeClient starts a fake DigitalOcean API and returns it with a client pointed at it
+func newFakeClient(t *testing.T) (*fakedo.Server, *godo.Client) {
+	server := fakedo.NewServer(t)
+	return server, CreateGodoClientWithOptionsT(t, &GodoClientOptions{BaseURL: server.URL, Token: fakedo.Token, MaxRetries: -1})
+}
+
+// newCassetteClient returns a client replaying testdata/cassettes/<TestName>.json, so the test checks the helpers
+// against recorded API responses. It never records: a request missing from the cassette fails the test.
+func newCassetteClient(t *testing.T) *godo.Client {
+	t.Setenv(cassette.ModeEnvVar, string(cassette.ModeReplay))
+	return CreateGodoClientWithCassetteT(t, filepath.Join("testdata", "cassettes", t.Name()+".json"))
+}
+
+func TestCreateGodoClientWithOptions(t *testing.T) {
+	var userAgents, authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if len(userAgents) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"vpcs": [{"ip_range": "10.0.0.0/24"}], "links": {}, "meta": {"total": 1}}`))
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	client, err := CreateGodoClientWithOptionsE(&GodoClientOptions{
+		Token:      "test-token",
+		UserAgent:  "sws-nightly",
+		MinBackoff: time.Millisecond,
+		Transport:  &redirectTransport{target: target},
+	})
+	require.NoError(t, err)
+
+	vpcs, _, err := client.VPCs.List(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, vpcs, 1)
+	assert.Equal(t, "10.0.0.0/24", vpcs[0].IPRange)
+
+	assert.Len(t, userAgents, 2, "the 429 should have been retried")
+	for i := range userAgents {
+		assert.True(t, strings.HasPrefix(userAgents[i], "sws-nightly godo/"), userAgents[i])
+		assert.Equal(t, "Bearer test-token", authorizations[i], "every attempt should be authenticated")
+	}
+}
+
+func TestCreateGodoClientE_MissingToken(t *testing.T) {
+	isolateGodoCredentials(t)
+
+	_, err := CreateGodoClientE()
+	assert.ErrorIs(t, err, ErrNoGodoCredentials)
+	assert.ErrorContains(t, err, "unable to create godo client: no DigitalOcean credentials found: set DIGITALOCEAN_ACCESS_TOKEN")
+}
+
+func TestCreateGodoClientE_DefaultUserAgent(t *testing.T) {
+	t.Setenv("DIGITALOCEAN_ACCESS_TOKEN", "test-token")
+
+	client, err := CreateGodoClientE()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(client.UserAgent, DefaultGodoUserAgent+" godo/"), client.UserAgent)
+}
+
+func TestCreateGodoClientE_BaseURLFromEnv(t *testing.T) {
+	server := fakedo.NewServer(t)
+	server.AddVPC(godo.VPC{Name: "existing", IPRange: "10.0.0.0/24"})
+	t.Setenv("DIGITALOCEAN_ACCESS_TOKEN", fakedo.Token)
+	t.Setenv("DIGITALOCEAN_API_URL", server.URL)
+
+	client, err := CreateGodoClientE()
+	require.NoError(t, err)
+	vpcs, _, err := client.VPCs.List(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, vpcs, 1)
+	assert.Equal(t, "existing", vpcs[0].Name)
+}
+
+func TestCreateGodoClientWithCassetteT(t *testing.T) {
+	t.Setenv("CASSETTE_MODE", "")
+	cassettePath := filepath.Join(t.TempDir(), "cassettes", "test.json")
+	server := fakedo.NewServer(t)
+	server.AddVPC(godo.VPC{Name: "vpc-a", IPRange: "10.0.0.0/24"})
+	server.AddKubernetesCluster(godo.KubernetesCluster{Name: "doks-a", ClusterSubnet: "10.1.0.0/19", ServiceSubnet: "10.2.0.0/22"}, []byte("apiVersion: v1\n"))
+
+	// Exercise the helpers against the API while recording, then against the cassette alone
+	var recorded, replayed []CidrRange
+	exercise := func(t *testing.T, ranges *[]CidrRange) {
+		client := CreateGodoClientWithCassetteT(t, cassettePath)
+		var err error
+		*ranges, err = collectCidrRanges(context.Background(), DefaultCidrSources(client))
+		require.NoError(t, err)
+		_, err = ConfigureKubectlE(t, client.Kubernetes, "doks-a", filepath.Join(t.TempDir(), "kubeconfig"), "default")
+		require.NoError(t, err)
+	}
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv("DIGITALOCEAN_ACCESS_TOKEN", fakedo.Token)
+		t.Setenv("DIGITALOCEAN_API_URL", server.URL)
+		exercise(t, &recorded)
+	})
+	require.FileExists(t, cassettePath, "the cassette is saved when the test passes")
+	server.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		t.Setenv("DIGITALOCEAN_ACCESS_TOKEN", "")
+		require.NoError(t, os.Unsetenv("DIGITALOCEAN_ACCESS_TOKEN"))
+		exercise(t, &replayed)
+	})
+	assert.Len(t, recorded, 3)
+	assert.Equal(t, recorded, replayed)
+}
+
+func TestCreateGodoClientsE(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"domains": [], "links": {}, "meta": {"total": 0}}`))
+	}))
+	defer server.Close()
+	configPath := isolateGodoCredentials(t)
+	t.Setenv("DIGITALOCEAN_ACCESS_TOKEN", "compute-token")
+	opts := &GodoClientOptions{BaseURL: server.URL}
+
+	clients, err := CreateGodoClientsE(opts)
+	require.NoError(t, err)
+	assert.Same(t, clients.Compute, clients.DNS, "DNS uses the compute client without separate credentials")
+
+	writeDoctlConfig(t, configPath, "auth-contexts:\n  dns: dns-team-token\n")
+	clients, err = CreateGodoClientsE(opts)
+	require.NoError(t, err)
+	_, _, err = clients.Compute.Domains.List(context.Background(), nil)
+	require.NoError(t, err)
+	_, _, err = clients.DNS.Domains.List(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer compute-token", "Bearer dns-team-token"}, authorizations)
+
+	t.Setenv("DIGITALOCEAN_DNS_CONTEXT", "missing")
+	clients, err = CreateGodoClientsE(opts)
+	require.NoError(t, err)
+	assert.Same(t, clients.Compute, clients.DNS)
+}
+
+func TestCreateGodoClientsE_ExplicitToken(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"domains": [], "links": {}, "meta": {"total": 0}}`))
+	}))
+	defer server.Close()
+	configPath := isolateGodoCredentials(t)
+	opts := &GodoClientOptions{BaseURL: server.URL, Token: "compute-token"}
+
+	// An explicit token is for compute; DNS still uses its own context
+	t.Setenv("DIGITALOCEAN_ACCESS_TOKEN_DNS", "dns-env-token")
+	clients, err := CreateGodoClientsE(opts)
+	require.NoError(t, err)
+	_, _, err = clients.Compute.Domains.List(context.Background(), nil)
+	require.NoError(t, err)
+	_, _, err = clients.DNS.Domains.List(context.Background(), nil)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Unsetenv("DIGITALOCEAN_ACCESS_TOKEN_DNS"))
+	writeDoctlConfig(t, configPath, "auth-contexts:\n  dns: dns-team-token\n")
+	clients, err = CreateGodoClientsE(opts)
+	require.NoError(t, err)
+	_, _, err = clients.DNS.Domains.List(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer compute-token", "Bearer dns-env-token", "Bearer dns-team-token"}, authorizations)
+
+	writeDoctlConfig(t, configPath, "auth-contexts: {}\n")
+	clients, err = CreateGodoClientsE(opts)
+	require.NoError(t, err)
+	assert.Same(t, clients.Compute, clients.DNS, "DNS uses the compute client without separate credentials")
+}
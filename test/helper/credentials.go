@@ -0,0 +1,151 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDnsGodoContext is the context whose credentials manage the root test domain (constant.TestRootSubdomain),
+// when it belongs to a different team's account than the resources under test.
+const DefaultDnsGodoContext = "dns"
+
+// ErrNoGodoCredentials is returned when no step of the credential chain yields an API token.
+var ErrNoGodoCredentials = errors.New("no DigitalOcean credentials found")
+
+// GodoCredential is an API token and where it was found.
+type GodoCredential struct {
+	Token  string
+	Source string // e.g. "DIGITALOCEAN_ACCESS_TOKEN" or "doctl context dns (/home/me/.config/doctl/config.yaml)"
+}
+
+// doctlConfig is the part of doctl's config.yaml holding credentials.
+type doctlConfig struct {
+	AccessToken  string            `yaml:"access-token"`
+	AuthContexts map[string]string `yaml:"auth-contexts"`
+	Context      string            `yaml:"context"`
+}
+
+// ResolveGodoCredentialE finds the API token for opts.Context, trying in order:
+//
+//  1. opts.Token
+//  2. $DIGITALOCEAN_ACCESS_TOKEN, or $DIGITALOCEAN_ACCESS_TOKEN_<CONTEXT> for a named context
+//  3. the context in doctl's config.yaml: the one doctl is switched to, or the named context
+//  4. the file at opts.TokenFile, $DIGITALOCEAN_ACCESS_TOKEN_FILE or $DIGITALOCEAN_ACCESS_TOKEN_<CONTEXT>_FILE
+//
+// When opts.Context is empty, $DIGITALOCEAN_CONTEXT names the context. The error matches ErrNoGodoCredentials
+// if every step comes up empty.
+func ResolveGodoCredentialE(opts *GodoClientOptions) (*GodoCredential, error) {
+	if opts == nil {
+		opts = &GodoClientOptions{}
+	}
+	if opts.Token != "" {
+		return &GodoCredential{Token: cleanToken(opts.Token), Source: "GodoClientOptions.Token"}, nil
+	}
+	context := opts.Context
+	if context == "" {
+		context = os.Getenv("DIGITALOCEAN_CONTEXT")
+	}
+
+	tokenVar := contextEnvVar(context)
+	if token := cleanToken(os.Getenv(tokenVar)); token != "" {
+		return &GodoCredential{Token: token, Source: tokenVar}, nil
+	}
+
+	configPath := opts.DoctlConfigPath
+	if configPath == "" {
+		configPath = defaultDoctlConfigPath()
+	}
+	credential, err := doctlCredential(configPath, context)
+	if err != nil || credential != nil {
+		return credential, err
+	}
+
+	tokenFileVar := tokenVar + "_FILE"
+	tokenFile := opts.TokenFile
+	if tokenFile == "" {
+		tokenFile = os.Getenv(tokenFileVar)
+	}
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read DigitalOcean token file: %w", err)
+		}
+		if token := cleanToken(string(data)); token != "" {
+			return &GodoCredential{Token: token, Source: tokenFile}, nil
+		}
+		return nil, fmt.Errorf("%w: token file %s is empty", ErrNoGodoCredentials, tokenFile)
+	}
+
+	contextDescription := "the current doctl context"
+	if context != "" {
+		contextDescription = fmt.Sprintf("doctl context %q", context)
+	}
+	return nil, fmt.Errorf("%w: set %s, add %s to %s, or set %s", ErrNoGodoCredentials, tokenVar, contextDescription, configPath, tokenFileVar)
+}
+
+// contextEnvVar returns the environment variable holding the token for context, e.g.
+// DIGITALOCEAN_ACCESS_TOKEN_DNS for "dns" and DIGITALOCEAN_ACCESS_TOKEN for the default context.
+func contextEnvVar(context string) string {
+	if context == "" || context == "default" {
+		return "DIGITALOCEAN_ACCESS_TOKEN"
+	}
+	suffix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, context)
+	return "DIGITALOCEAN_ACCESS_TOKEN_" + suffix
+}
+
+// defaultDoctlConfigPath returns where doctl keeps its config, e.g. ~/.config/doctl/config.yaml on Linux.
+func defaultDoctlConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join("doctl", "config.yaml")
+	}
+	return filepath.Join(dir, "doctl", "config.yaml")
+}
+
+// doctlCredential returns the token for context from the doctl config at path, or nil if the config
+// does not exist or has no token for it. An empty context means the one doctl is switched to.
+func doctlCredential(path, context string) (*GodoCredential, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read doctl config: %w", err)
+	}
+	var config doctlConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse doctl config %s: %w", path, err)
+	}
+
+	if context == "" {
+		context = config.Context
+	}
+	token := config.AccessToken
+	if context != "" && context != "default" {
+		token = config.AuthContexts[context]
+	} else {
+		context = "default"
+	}
+	if token = cleanToken(token); token == "" {
+		return nil, nil
+	}
+	return &GodoCredential{Token: token, Source: fmt.Sprintf("doctl context %s (%s)", context, path)}, nil
+}
+
+// cleanToken trims whitespace and the quotes a token is sometimes pasted with.
+func cleanToken(token string) string {
+	return strings.Trim(strings.TrimSpace(token), "'\"")
+}
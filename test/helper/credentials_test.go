@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateGodoCredentials clears every credential the chain reads from the environment and points doctl's config
+// directory at an empty temporary one. It returns where doctl's config.yaml would be.
+func isolateGodoCredentials(t *testing.T) string {
+	for _, name := range []string{
+		"DIGITALOCEAN_ACCESS_TOKEN", "DIGITALOCEAN_ACCESS_TOKEN_FILE", "DIGITALOCEAN_CONTEXT",
+		"DIGITALOCEAN_ACCESS_TOKEN_DNS", "DIGITALOCEAN_ACCESS_TOKEN_DNS_FILE", "DIGITALOCEAN_DNS_CONTEXT",
+	} {
+		t.Setenv(name, "")
+		require.NoError(t, os.Unsetenv(name))
+	}
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	configPath, err := os.UserConfigDir()
+	require.NoError(t, err)
+	return filepath.Join(configPath, "doctl", "config.yaml")
+}
+
+func writeDoctlConfig(t *testing.T, path, config string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+}
+
+const testDoctlConfig = `access-token: default-token
+auth-contexts:
+  dns: dns-team-token
+  personal: personal-token
+context: personal
+output: text
+`
+
+func TestResolveGodoCredentialE(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           *GodoClientOptions
+		env            map[string]string
+		doctlConfig    string
+		tokenFile      string
+		expectedToken  string
+		expectedSource string
+	}{
+		{
+			name:           "Explicit token wins",
+			opts:           &GodoClientOptions{Token: " 'explicit-token' "},
+			env:            map[string]string{"DIGITALOCEAN_ACCESS_TOKEN": "env-token"},
+			expectedToken:  "explicit-token",
+			expectedSource: "GodoClientOptions.Token",
+		},
+		{
+			name:           "Environment before doctl",
+			env:            map[string]string{"DIGITALOCEAN_ACCESS_TOKEN": "env-token"},
+			doctlConfig:    testDoctlConfig,
+			expectedToken:  "env-token",
+			expectedSource: "DIGITALOCEAN_ACCESS_TOKEN",
+		},
+		{
+			name:           "Named context from the environment",
+			opts:           &GodoClientOptions{Context: "dns"},
+			env:            map[string]string{"DIGITALOCEAN_ACCESS_TOKEN": "env-token", "DIGITALOCEAN_ACCESS_TOKEN_DNS": "env-dns-token"},
+			expectedToken:  "env-dns-token",
+			expectedSource: "DIGITALOCEAN_ACCESS_TOKEN_DNS",
+		},
+		{
+			name:          "doctl's current context",
+			doctlConfig:   testDoctlConfig,
+			expectedToken: "personal-token",
+		},
+		{
+			name:          "Named doctl context",
+			opts:          &GodoClientOptions{Context: "dns"},
+			doctlConfig:   testDoctlConfig,
+			expectedToken: "dns-team-token",
+		},
+		{
+			name:          "Context chosen by the environment",
+			env:           map[string]string{"DIGITALOCEAN_CONTEXT": "default"},
+			doctlConfig:   testDoctlConfig,
+			expectedToken: "default-token",
+		},
+		{
+			name:           "doctl before the token file",
+			doctlConfig:    "access-token: default-token\n",
+			tokenFile:      "file-token\n",
+			expectedToken:  "default-token",
+			expectedSource: "doctl context default",
+		},
+		{
+			name:           "Token file when nothing else is set",
+			tokenFile:      "file-token\n",
+			expectedToken:  "file-token",
+			expectedSource: "token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := isolateGodoCredentials(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if tt.doctlConfig != "" {
+				writeDoctlConfig(t, configPath, tt.doctlConfig)
+			}
+			if tt.tokenFile != "" {
+				tokenFile := filepath.Join(t.TempDir(), "token")
+				require.NoError(t, os.WriteFile(tokenFile, []byte(tt.tokenFile), 0600))
+				t.Setenv("DIGITALOCEAN_ACCESS_TOKEN_FILE", tokenFile)
+			}
+
+			credential, err := ResolveGodoCredentialE(tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedToken, credential.Token)
+			if tt.expectedSource != "" {
+				assert.Contains(t, credential.Source, tt.expectedSource)
+			}
+		})
+	}
+}
+
+func TestResolveGodoCredentialE_TokenFile(t *testing.T) {
+	isolateGodoCredentials(t)
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "dns-token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-dns-token\n"), 0600))
+
+	t.Setenv("DIGITALOCEAN_ACCESS_TOKEN_DNS_FILE", tokenFile)
+	credential, err := ResolveGodoCredentialE(&GodoClientOptions{Context: "dns"})
+	require.NoError(t, err)
+	assert.Equal(t, &GodoCredential{Token: "file-dns-token", Source: tokenFile}, credential)
+
+	emptyFile := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("\n"), 0600))
+	_, err = ResolveGodoCredentialE(&GodoClientOptions{TokenFile: emptyFile})
+	assert.ErrorIs(t, err, ErrNoGodoCredentials)
+
+	_, err = ResolveGodoCredentialE(&GodoClientOptions{TokenFile: filepath.Join(dir, "missing")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestResolveGodoCredentialE_NoCredentials(t *testing.T) {
+	configPath := isolateGodoCredentials(t)
+
+	_, err := ResolveGodoCredentialE(nil)
+	assert.ErrorIs(t, err, ErrNoGodoCredentials)
+	assert.EqualError(t, err, "no DigitalOcean credentials found: set DIGITALOCEAN_ACCESS_TOKEN, add the current doctl context to "+
+		configPath+", or set DIGITALOCEAN_ACCESS_TOKEN_FILE")
+
+	writeDoctlConfig(t, configPath, testDoctlConfig)
+	_, err = ResolveGodoCredentialE(&GodoClientOptions{Context: "ci-team"})
+	assert.EqualError(t, err, `no DigitalOcean credentials found: set DIGITALOCEAN_ACCESS_TOKEN_CI_TEAM, add doctl context "ci-team" to `+
+		configPath+", or set DIGITALOCEAN_ACCESS_TOKEN_CI_TEAM_FILE")
+}
+
+func TestResolveGodoCredentialE_InvalidDoctlConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeDoctlConfig(t, configPath, "auth-contexts: [not, a, map]\n")
+
+	_, err := ResolveGodoCredentialE(&GodoClientOptions{DoctlConfigPath: configPath, Context: "dns"})
+	assert.ErrorContains(t, err, "unable to parse doctl config "+configPath)
+}
@@ -2,20 +2,32 @@ package helper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
 	"log"
+	"testing"
 )
 
-func CreateTestDomain(client *godo.Client, parentFqdn, testDomainName string) string {
+// CreateTestDomainE creates the domain <testDomainName>.<parentFqdn> and delegates it from the parent
+// domain with NS records. It returns the FQDN of the test domain. domains is usually godo.Client.Domains.
+func CreateTestDomainE(domains doservice.DomainService, parentFqdn, testDomainName string) (string, error) {
+	return CreateDelegatedTestDomainE(domains, domains, parentFqdn, testDomainName)
+}
+
+// CreateDelegatedTestDomainE is like CreateTestDomainE, but creates the test domain with domains and the NS
+// records with parentDomains, for when the parent domain is in another account (see GodoClients). If an NS
+// record can't be created, the domain and the records already created are deleted before the error is returned.
+func CreateDelegatedTestDomainE(domains, parentDomains doservice.DomainService, parentFqdn, testDomainName string) (string, error) {
 	testDomainFqdn := fmt.Sprintf("%s.%s", testDomainName, parentFqdn)
 	domainCreateRequest := &godo.DomainCreateRequest{Name: testDomainFqdn}
 	ctx := context.TODO()
 
 	log.Printf("Creating domain: %s", testDomainFqdn)
-	_, _, err := client.Domains.Create(ctx, domainCreateRequest)
+	_, _, err := domains.Create(ctx, domainCreateRequest)
 	if err != nil {
-		log.Panicf("Failed to create domain %s: %v", testDomainFqdn, err)
+		return "", fmt.Errorf("failed to create domain %s: %w", testDomainFqdn, err)
 	}
 	log.Printf("Successfully created domain: %s", testDomainFqdn)
 	log.Printf("Creating NS records in %s", parentFqdn)
@@ -26,34 +38,104 @@ func CreateTestDomain(client *godo.Client, parentFqdn, testDomainName string) st
 			Data: fmt.Sprintf("ns%v.digitalocean.com.", i),
 			TTL:  1800,
 		}
-		_, _, err := client.Domains.CreateRecord(ctx, parentFqdn, recordCreateRequest)
+		_, _, err := parentDomains.CreateRecord(ctx, parentFqdn, recordCreateRequest)
 		if err != nil {
-			log.Panicf("Failed to create NS record %d for domain %s: %v", i, testDomainFqdn, err)
+			err = fmt.Errorf("failed to create NS record %d for domain %s: %w", i, testDomainFqdn, err)
+			if cleanupErr := DeleteDelegatedTestDomainE(domains, parentDomains, parentFqdn, testDomainName); cleanupErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to clean up domain %s: %w", testDomainFqdn, cleanupErr))
+			}
+			return "", err
 		}
 	}
 	log.Printf("Successfully created NS records in %s", parentFqdn)
+	return testDomainFqdn, nil
+}
+
+// CreateTestDomainT is like CreateTestDomainE but fails the test on error and registers
+// DeleteTestDomainE with t.Cleanup so the domain is removed when the test finishes.
+func CreateTestDomainT(t testing.TB, domains doservice.DomainService, parentFqdn, testDomainName string) string {
+	t.Helper()
+	return CreateDelegatedTestDomainT(t, domains, domains, parentFqdn, testDomainName)
+}
+
+// CreateDelegatedTestDomainT is like CreateDelegatedTestDomainE but fails the test on error and registers
+// DeleteDelegatedTestDomainE with t.Cleanup so the domain is removed when the test finishes.
+func CreateDelegatedTestDomainT(t testing.TB, domains, parentDomains doservice.DomainService, parentFqdn, testDomainName string) string {
+	t.Helper()
+	testDomainFqdn, err := CreateDelegatedTestDomainE(domains, parentDomains, parentFqdn, testDomainName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := DeleteDelegatedTestDomainE(domains, parentDomains, parentFqdn, testDomainName); err != nil {
+			t.Errorf("Failed to clean up test domain: %v", err)
+		}
+	})
 	return testDomainFqdn
 }
 
-func DeleteTestDomain(client *godo.Client, parentFqdn, testDomainName string) {
+// CreateTestDomain is like CreateTestDomainE, using client.Domains, but panics on error.
+func CreateTestDomain(client *godo.Client, parentFqdn, testDomainName string) string {
+	testDomainFqdn, err := CreateTestDomainE(client.Domains, parentFqdn, testDomainName)
+	if err != nil {
+		log.Panic(err)
+	}
+	return testDomainFqdn
+}
+
+// DeleteTestDomainE deletes the domain <testDomainName>.<parentFqdn> and its NS records in the parent domain.
+func DeleteTestDomainE(domains doservice.DomainService, parentFqdn, testDomainName string) error {
+	return DeleteDelegatedTestDomainE(domains, domains, parentFqdn, testDomainName)
+}
+
+// DeleteDelegatedTestDomainE is like DeleteTestDomainE, but deletes the test domain with domains and the NS
+// records with parentDomains. The NS records are deleted even if the domain can't be, so no delegation is left
+// dangling in the parent domain; every error is returned.
+func DeleteDelegatedTestDomainE(domains, parentDomains doservice.DomainService, parentFqdn, testDomainName string) error {
 	ctx := context.TODO()
 	testDomainFqdn := fmt.Sprintf("%s.%s", testDomainName, parentFqdn)
+	var errs []error
 	log.Printf("Deleting domain: %s", testDomainFqdn)
-	_, err := client.Domains.Delete(ctx, testDomainFqdn)
-	if err != nil {
-		log.Panicf("Failed to delete domain %s: %v", testDomainFqdn, err)
+	if _, err := domains.Delete(ctx, testDomainFqdn); err != nil {
+		errs = append(errs, fmt.Errorf("failed to delete domain %s: %w", testDomainFqdn, err))
+	} else {
+		log.Printf("Successfully deleted domain: %s", testDomainFqdn)
 	}
-	log.Printf("Successfully deleted domain: %s", testDomainFqdn)
 	log.Printf("Deleting NS records in %s", parentFqdn)
-	nsRecords, _, err := client.Domains.RecordsByName(ctx, parentFqdn, testDomainFqdn, nil)
+	if err := deleteNsRecords(ctx, parentDomains, parentFqdn, testDomainFqdn); err != nil {
+		errs = append(errs, err)
+	} else {
+		log.Printf("Successfully deleted NS records in %s", parentFqdn)
+	}
+	return errors.Join(errs...)
+}
+
+// deleteNsRecords deletes the records named testDomainFqdn in the parent domain, carrying on past failures.
+func deleteNsRecords(ctx context.Context, parentDomains doservice.DomainService, parentFqdn, testDomainFqdn string) error {
+	nsRecords, _, err := parentDomains.RecordsByName(ctx, parentFqdn, testDomainFqdn, nil)
 	if err != nil {
-		log.Panicf("Failed to get NS records %s in domain %s: %v", testDomainFqdn, parentFqdn, err)
+		return fmt.Errorf("failed to get NS records %s in domain %s: %w", testDomainFqdn, parentFqdn, err)
 	}
+	var errs []error
 	for _, record := range nsRecords {
-		_, err := client.Domains.DeleteRecord(ctx, parentFqdn, record.ID)
-		if err != nil {
-			log.Panicf("Failed to delete NS record %d for domain %s: %v", record.ID, testDomainFqdn, err)
+		if _, err := parentDomains.DeleteRecord(ctx, parentFqdn, record.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete NS record %d for domain %s: %w", record.ID, testDomainFqdn, err))
 		}
 	}
-	log.Printf("Successfully deleted NS records in %s", parentFqdn)
+	return errors.Join(errs...)
+}
+
+// DeleteTestDomainT is like DeleteTestDomainE but fails the test on error.
+func DeleteTestDomainT(t testing.TB, domains doservice.DomainService, parentFqdn, testDomainName string) {
+	t.Helper()
+	if err := DeleteTestDomainE(domains, parentFqdn, testDomainName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// DeleteTestDomain is like DeleteTestDomainE, using client.Domains, but panics on error.
+func DeleteTestDomain(client *godo.Client, parentFqdn, testDomainName string) {
+	if err := DeleteTestDomainE(client.Domains, parentFqdn, testDomainName); err != nil {
+		log.Panic(err)
+	}
 }
@@ -0,0 +1,131 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice/doservicefakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nsRecords returns the data of the NS records named name in records
+func nsRecords(records []godo.DomainRecord, name string) []string {
+	var data []string
+	for _, record := range records {
+		if record.Type == "NS" && record.Name == name {
+			data = append(data, record.Data)
+		}
+	}
+	return data
+}
+
+func TestCreateTestDomainE(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.AddDomain("example.com")
+
+	fqdn, err := CreateTestDomainE(client.Domains, "example.com", "test-abc")
+	require.NoError(t, err)
+	assert.Equal(t, "test-abc.example.com", fqdn)
+	assert.ElementsMatch(t, []string{"example.com", "test-abc.example.com"}, server.Domains())
+	assert.Equal(t, []string{"ns1.digitalocean.com.", "ns2.digitalocean.com.", "ns3.digitalocean.com."},
+		nsRecords(server.Records("example.com"), "test-abc"))
+}
+
+func TestCreateDelegatedTestDomainE(t *testing.T) {
+	// The parent domain belongs to another team's account
+	computeServer, compute := newFakeClient(t)
+	dnsServer, dns := newFakeClient(t)
+	dnsServer.AddDomain("example.com")
+
+	fqdn, err := CreateDelegatedTestDomainE(compute.Domains, dns.Domains, "example.com", "test-abc")
+	require.NoError(t, err)
+	assert.Equal(t, "test-abc.example.com", fqdn)
+	assert.Equal(t, []string{"test-abc.example.com"}, computeServer.Domains())
+	assert.Equal(t, []string{"example.com"}, dnsServer.Domains())
+	assert.Len(t, nsRecords(dnsServer.Records("example.com"), "test-abc"), 3)
+
+	require.NoError(t, DeleteDelegatedTestDomainE(compute.Domains, dns.Domains, "example.com", "test-abc"))
+	assert.Empty(t, computeServer.Domains())
+	assert.Empty(t, nsRecords(dnsServer.Records("example.com"), "test-abc"))
+}
+
+func TestCreateTestDomainE_MissingParent(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	_, err := CreateTestDomainE(client.Domains, "example.com", "test-abc")
+	assert.ErrorContains(t, err, "failed to create NS record 1 for domain test-abc.example.com")
+	assert.Empty(t, server.Domains(), "the domain is deleted again")
+}
+
+func TestCreateDelegatedTestDomainE_RollsBackWhenRecordFails(t *testing.T) {
+	domains := &doservicefakes.FakeDomainService{}
+	parentDomains := &doservicefakes.FakeDomainService{}
+	parentDomains.CreateRecordReturnsOnCall(0, &godo.DomainRecord{ID: 41, Type: "NS", Name: "test-abc"}, nil, nil)
+	parentDomains.CreateRecordReturnsOnCall(1, nil, nil, errors.New("service unavailable"))
+	parentDomains.RecordsByNameReturns([]godo.DomainRecord{{ID: 41, Type: "NS", Name: "test-abc"}}, nil, nil)
+
+	_, err := CreateDelegatedTestDomainE(domains, parentDomains, "example.com", "test-abc")
+	assert.EqualError(t, err, "failed to create NS record 2 for domain test-abc.example.com: service unavailable")
+	assert.Equal(t, 2, parentDomains.CreateRecordCallCount(), "no records are created after a failure")
+	require.Equal(t, 1, domains.DeleteCallCount())
+	_, deleted := domains.DeleteArgsForCall(0)
+	assert.Equal(t, "test-abc.example.com", deleted)
+	require.Equal(t, 1, parentDomains.DeleteRecordCallCount())
+	_, parent, recordID := parentDomains.DeleteRecordArgsForCall(0)
+	assert.Equal(t, "example.com", parent)
+	assert.Equal(t, 41, recordID)
+}
+
+func TestDeleteTestDomainE(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.AddDomain("example.com")
+	_, err := CreateTestDomainE(client.Domains, "example.com", "test-abc")
+	require.NoError(t, err)
+	_, err = CreateTestDomainE(client.Domains, "example.com", "test-def")
+	require.NoError(t, err)
+
+	require.NoError(t, DeleteTestDomainE(client.Domains, "example.com", "test-abc"))
+	assert.ElementsMatch(t, []string{"example.com", "test-def.example.com"}, server.Domains())
+	assert.Empty(t, nsRecords(server.Records("example.com"), "test-abc"))
+	assert.Len(t, nsRecords(server.Records("example.com"), "test-def"), 3, "other delegations are kept")
+
+	assert.ErrorContains(t, DeleteTestDomainE(client.Domains, "example.com", "test-abc"), "failed to delete domain test-abc.example.com")
+}
+
+func TestDeleteTestDomainE_RecordLookupFails(t *testing.T) {
+	domains := &doservicefakes.FakeDomainService{}
+	domains.RecordsByNameReturns(nil, nil, errors.New("service unavailable"))
+
+	err := DeleteTestDomainE(domains, "example.com", "test-abc")
+	assert.EqualError(t, err, "failed to get NS records test-abc.example.com in domain example.com: service unavailable")
+	_, deleted := domains.DeleteArgsForCall(0)
+	assert.Equal(t, "test-abc.example.com", deleted)
+	assert.Zero(t, domains.DeleteRecordCallCount())
+}
+
+func TestDeleteDelegatedTestDomainE_DeletesRecordsWhenDomainDeleteFails(t *testing.T) {
+	domains := &doservicefakes.FakeDomainService{}
+	domains.DeleteReturns(nil, errors.New("forbidden"))
+	parentDomains := &doservicefakes.FakeDomainService{}
+	parentDomains.RecordsByNameReturns([]godo.DomainRecord{{ID: 41}, {ID: 42}, {ID: 43}}, nil, nil)
+	parentDomains.DeleteRecordReturnsOnCall(1, nil, errors.New("timeout"))
+
+	err := DeleteDelegatedTestDomainE(domains, parentDomains, "example.com", "test-abc")
+	assert.EqualError(t, err, "failed to delete domain test-abc.example.com: forbidden\n"+
+		"failed to delete NS record 42 for domain test-abc.example.com: timeout")
+	assert.Equal(t, 3, parentDomains.DeleteRecordCallCount(), "every record is attempted")
+}
+
+func TestCreateTestDomainT_DeletesDomainOnCleanup(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.AddDomain("example.com")
+
+	t.Run("create", func(t *testing.T) {
+		CreateTestDomainT(t, client.Domains, "example.com", "test-abc")
+		assert.Len(t, server.Domains(), 2)
+	})
+	assert.Equal(t, []string{"example.com"}, server.Domains())
+	assert.Empty(t, nsRecords(server.Records("example.com"), "test-abc"))
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/logger"
 	"github.com/gruntwork-io/terratest/modules/random"
@@ -197,22 +198,24 @@ func RunPod(t *testing.T, kubectlOptions *k8s.KubectlOptions, opts PodRunOptions
 	return result, nil
 }
 
-// ConfigureKubectl writes a kubeconfig file for a DOKS cluster and returns kubectl options.
-// It fetches the kubeconfig via the DigitalOcean API using the cluster name.
-func ConfigureKubectl(t *testing.T, client *godo.Client, clusterName string, kubeconfigPath string, namespace string) *k8s.KubectlOptions {
+// ConfigureKubectlE writes a kubeconfig file for a DOKS cluster and returns kubectl options.
+// It fetches the kubeconfig via the DigitalOcean API using the cluster name. clusters is usually godo.Client.Kubernetes.
+func ConfigureKubectlE(t testing.TB, clusters doservice.KubernetesClusterService, clusterName string, kubeconfigPath string, namespace string) (*k8s.KubectlOptions, error) {
 	ctx := context.Background()
 
 	// Get the cluster's kubeconfig via DigitalOcean API
 	logger.Logf(t, "Fetching kubeconfig for cluster: %s", clusterName)
 
 	// List all clusters and find ours by name
-	clusters, _, err := client.Kubernetes.List(ctx, nil)
+	clusterList, err := listAllPages(func(opt *godo.ListOptions) ([]*godo.KubernetesCluster, *godo.Response, error) {
+		return clusters.List(ctx, opt)
+	})
 	if err != nil {
-		t.Fatalf("Failed to list clusters: %v", err)
+		return nil, fmt.Errorf("failed to list clusters: %w", err)
 	}
 
 	var clusterID string
-	for _, cluster := range clusters {
+	for _, cluster := range clusterList {
 		if cluster.Name == clusterName {
 			clusterID = cluster.ID
 			break
@@ -220,23 +223,39 @@ func ConfigureKubectl(t *testing.T, client *godo.Client, clusterName string, kub
 	}
 
 	if clusterID == "" {
-		t.Fatalf("Cluster %s not found", clusterName)
+		return nil, fmt.Errorf("cluster %s not found", clusterName)
 	}
 
 	// Get kubeconfig for the cluster
-	kubeconfig, _, err := client.Kubernetes.GetKubeConfig(ctx, clusterID)
+	kubeconfig, _, err := clusters.GetKubeConfig(ctx, clusterID)
 	if err != nil {
-		t.Fatalf("Failed to get kubeconfig: %v", err)
+		return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
 	}
 
 	// Write kubeconfig content to file
 	err = os.WriteFile(kubeconfigPath, kubeconfig.KubeconfigYAML, 0600)
 	if err != nil {
-		t.Fatalf("Failed to write kubeconfig: %v", err)
+		return nil, fmt.Errorf("failed to write kubeconfig: %w", err)
 	}
 
 	logger.Logf(t, "Kubeconfig written to: %s", kubeconfigPath)
 
 	// Return kubectl options with the kubeconfig path
-	return k8s.NewKubectlOptions("", kubeconfigPath, namespace)
+	return k8s.NewKubectlOptions("", kubeconfigPath, namespace), nil
+}
+
+// ConfigureKubectlT is like ConfigureKubectlE but fails the test on error.
+func ConfigureKubectlT(t testing.TB, clusters doservice.KubernetesClusterService, clusterName string, kubeconfigPath string, namespace string) *k8s.KubectlOptions {
+	t.Helper()
+	kubectlOptions, err := ConfigureKubectlE(t, clusters, clusterName, kubeconfigPath, namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kubectlOptions
+}
+
+// ConfigureKubectl is like ConfigureKubectlT, using client.Kubernetes.
+func ConfigureKubectl(t *testing.T, client *godo.Client, clusterName string, kubeconfigPath string, namespace string) *k8s.KubectlOptions {
+	t.Helper()
+	return ConfigureKubectlT(t, client.Kubernetes, clusterName, kubeconfigPath, namespace)
 }
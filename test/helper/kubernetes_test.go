@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/fakedo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureKubectlE(t *testing.T) {
+	server, client := newFakeClient(t)
+	// More clusters than fit in one page, so the one we want is on the second
+	for i := 0; i < fakedo.DefaultPageSize+5; i++ {
+		server.AddKubernetesCluster(godo.KubernetesCluster{Name: fmt.Sprintf("cluster-%d", i)}, []byte("other"))
+	}
+	server.AddKubernetesCluster(godo.KubernetesCluster{Name: "target"}, []byte("apiVersion: v1\nkind: Config\n"))
+	kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+
+	options, err := ConfigureKubectlE(t, client.Kubernetes, "target", kubeconfigPath, "apps")
+	require.NoError(t, err)
+	assert.Equal(t, kubeconfigPath, options.ConfigPath)
+	assert.Equal(t, "apps", options.Namespace)
+
+	kubeconfig, err := os.ReadFile(kubeconfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1\nkind: Config\n", string(kubeconfig))
+	info, err := os.Stat(kubeconfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestConfigureKubectlE_Cassette(t *testing.T) {
+	kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+
+	options, err := ConfigureKubectlE(t, newCassetteClient(t).Kubernetes, "prod-doks", kubeconfigPath, "default")
+	require.NoError(t, err)
+	assert.Equal(t, kubeconfigPath, options.ConfigPath)
+
+	kubeconfig, err := os.ReadFile(kubeconfigPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(kubeconfig), "server: https://00000000-0000-47ed-8fa9-645cd6617319.k8s.ondigitalocean.com\n")
+	assert.Contains(t, string(kubeconfig), "current-context: do-nyc3-prod-doks\n")
+}
+
+func TestConfigureKubectlE_ClusterNotFound(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.AddKubernetesCluster(godo.KubernetesCluster{Name: "other"}, []byte("other"))
+
+	_, err := ConfigureKubectlE(t, client.Kubernetes, "target", filepath.Join(t.TempDir(), "kubeconfig"), "default")
+	assert.EqualError(t, err, "cluster target not found")
+}
@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
+)
+
+// PartnerAttachmentHasRouteE reports whether cidr is one of the remote routes of the Partner Network Connect
+// attachment attachmentID, reading every page of routes. attachments is usually godo.Client.PartnerAttachment.
+func PartnerAttachmentHasRouteE(attachments doservice.PartnerAttachmentRouteLister, attachmentID, cidr string) (bool, error) {
+	ctx := context.TODO()
+	routes, err := listAllPages(func(opt *godo.ListOptions) ([]*godo.RemoteRoute, *godo.Response, error) {
+		return attachments.ListRoutes(ctx, attachmentID, opt)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list routes for partner attachment %s: %w", attachmentID, err)
+	}
+	for _, route := range routes {
+		if route.Cidr == cidr {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PartnerAttachmentHasRouteT is like PartnerAttachmentHasRouteE but fails the test on error.
+func PartnerAttachmentHasRouteT(t testing.TB, attachments doservice.PartnerAttachmentRouteLister, attachmentID, cidr string) bool {
+	t.Helper()
+	found, err := PartnerAttachmentHasRouteE(attachments, attachmentID, cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
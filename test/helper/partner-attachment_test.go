@@ -0,0 +1,44 @@
+package helper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/fakedo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartnerAttachmentHasRouteE(t *testing.T) {
+	server, client := newFakeClient(t)
+	// Enough routes to span several pages, with the one we look for on the last
+	routes := make([]string, 0, 2*fakedo.DefaultPageSize+1)
+	for i := 0; i < 2*fakedo.DefaultPageSize; i++ {
+		routes = append(routes, fmt.Sprintf("10.%d.0.0/16", i))
+	}
+	routes = append(routes, "192.168.1.0/24")
+	attachment := server.AddPartnerAttachment(godo.PartnerAttachment{Name: "pnc"}, routes...)
+
+	assert.True(t, PartnerAttachmentHasRouteT(t, client.PartnerAttachment, attachment.ID, "192.168.1.0/24"))
+	assert.True(t, PartnerAttachmentHasRouteT(t, client.PartnerAttachment, attachment.ID, "10.0.0.0/16"))
+	assert.False(t, PartnerAttachmentHasRouteT(t, client.PartnerAttachment, attachment.ID, "192.168.2.0/24"))
+
+	_, err := PartnerAttachmentHasRouteE(client.PartnerAttachment, "missing", "192.168.1.0/24")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to list routes for partner attachment missing")
+	assert.True(t, isNotFound(err))
+}
+
+func TestPartnerAttachmentHasRouteE_Cassette(t *testing.T) {
+	client := newCassetteClient(t)
+
+	// The attachment has 102 routes, so the one we look for is on the second page
+	found, err := PartnerAttachmentHasRouteE(client.PartnerAttachment, "00000000-0000-438b-8c73-142189ec85c3", "192.168.1.0/24")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	_, err = PartnerAttachmentHasRouteE(client.PartnerAttachment, "00000000-0000-487d-8201-61f3a4af6edd", "192.168.1.0/24")
+	require.Error(t, err)
+	assert.True(t, isNotFound(err))
+}
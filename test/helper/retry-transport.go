@@ -0,0 +1,218 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+	headerRetryAfter         = "Retry-After"
+)
+
+// retryTransport is an http.RoundTripper that retries requests failing with 429 or 5xx responses using
+// exponential backoff with jitter. It also honours the DigitalOcean rate-limit headers: a 429 is retried
+// no earlier than RateLimit-Reset (or Retry-After), and once RateLimit-Remaining reaches zero every request
+// waits for the reset instead of being rejected. Requests that are not idempotent, such as the POST creating a
+// key or Droplet, are only retried when the server provably did not carry them out: after a 429, or when no
+// connection could be made. Repeating one after a 5xx or a dropped connection could create a duplicate.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu          sync.Mutex
+	pausedUntil time.Time // When the rate limit resets after RateLimit-Remaining reached zero
+
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration // Returns a random duration in [0, d)
+}
+
+// newRetryTransport wraps base (http.DefaultTransport if nil) with retries.
+func newRetryTransport(base http.RoundTripper, maxRetries int, minBackoff, maxBackoff time.Duration) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		now:        time.Now,
+		sleep:      sleepContext,
+		jitter: func(d time.Duration) time.Duration {
+			if d <= 0 {
+				return 0
+			}
+			return time.Duration(rand.Int63n(int64(d)))
+		},
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := rt.waitForRateLimit(ctx); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(ctx)
+			if req.Body != nil && req.Body != http.NoBody {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		resp, err := rt.base.RoundTrip(attemptReq)
+		rt.observeRateLimit(resp)
+
+		wait, retry := rt.retryAfter(req, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		log.Printf("Retrying %s %s in %s after %s (retry %d of %d)", req.Method, req.URL.Path, wait.Round(time.Millisecond), reason, attempt+1, rt.maxRetries)
+		if err := rt.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter decides whether a failed attempt should be retried and, if so, how long to wait first.
+func (rt *retryTransport) retryAfter(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= rt.maxRetries || req.Context().Err() != nil {
+		return 0, false
+	}
+	// A request body that cannot be replayed cannot be retried
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+
+	switch {
+	case err != nil:
+		// The request may have been processed, so only retry methods that are safe to repeat
+		if !isIdempotent(req.Method) && !neverSent(err) {
+			return 0, false
+		}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return max(rt.backoff(attempt), rt.rateLimitWait(resp)), true
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+		// The server may have committed the write before failing
+		if !isIdempotent(req.Method) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return rt.backoff(attempt), true
+}
+
+// backoff returns the wait before retry number attempt+1: an exponentially growing delay, capped at
+// maxBackoff, of which the second half is random so that parallel tests don't retry in lockstep.
+func (rt *retryTransport) backoff(attempt int) time.Duration {
+	d := rt.maxBackoff
+	if attempt < 32 && rt.minBackoff<<attempt < rt.maxBackoff {
+		d = rt.minBackoff << attempt
+	}
+	return d/2 + rt.jitter(d/2)
+}
+
+// rateLimitWait returns how long a 429 response asks the client to wait, from Retry-After or RateLimit-Reset.
+func (rt *retryTransport) rateLimitWait(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get(headerRetryAfter)); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if reset, ok := parseRateLimitReset(resp); ok {
+		return reset.Sub(rt.now())
+	}
+	return 0
+}
+
+// observeRateLimit pauses further requests until the reset time once the rate limit is used up.
+func (rt *retryTransport) observeRateLimit(resp *http.Response) {
+	if resp == nil || resp.Header.Get(headerRateLimitRemaining) != "0" {
+		return
+	}
+	reset, ok := parseRateLimitReset(resp)
+	if !ok {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if reset.After(rt.pausedUntil) {
+		rt.pausedUntil = reset
+	}
+}
+
+// waitForRateLimit blocks until the rate limit resets, if it has been used up.
+func (rt *retryTransport) waitForRateLimit(ctx context.Context) error {
+	rt.mu.Lock()
+	wait := rt.pausedUntil.Sub(rt.now())
+	rt.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	log.Printf("DigitalOcean API rate limit reached, waiting %s for it to reset", wait.Round(time.Second))
+	return rt.sleep(ctx, wait)
+}
+
+// parseRateLimitReset reads RateLimit-Reset, the Unix time at which the rate limit resets.
+func parseRateLimitReset(resp *http.Response) (time.Time, bool) {
+	reset, err := strconv.ParseInt(resp.Header.Get(headerRateLimitReset), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(reset, 0), true
+}
+
+// isIdempotent reports whether repeating a request with method has the same effect as sending it once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// neverSent reports whether err shows the request never reached the server, because no connection was made.
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// sleepContext sleeps for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedServer replies to each request with the next status code and headers in its script, then 200 OK
+type scriptedServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	script   []scriptedResponse
+	requests []string // Method and body of each request received
+}
+
+type scriptedResponse struct {
+	status int
+	header map[string]string
+}
+
+func newScriptedServer(t *testing.T, script ...scriptedResponse) *scriptedServer {
+	s := &scriptedServer{script: script}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Method+" "+string(body))
+		status := http.StatusOK
+		if len(s.script) > 0 {
+			for k, v := range s.script[0].header {
+				w.Header().Set(k, v)
+			}
+			status = s.script[0].status
+			s.script = s.script[1:]
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newTestRetryTransport returns a retryTransport with no jitter that records its sleeps and advances a fake
+// clock starting at now instead of sleeping
+func newTestRetryTransport(maxRetries int, now time.Time) (*retryTransport, *[]time.Duration) {
+	var sleeps []time.Duration
+	rt := newRetryTransport(nil, maxRetries, time.Second, 8*time.Second)
+	rt.now = func() time.Time { return now }
+	rt.jitter = func(time.Duration) time.Duration { return 0 }
+	rt.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+	return rt, &sleeps
+}
+
+func TestRetryTransport_RetriesServerErrors(t *testing.T) {
+	server := newScriptedServer(t,
+		scriptedResponse{status: http.StatusBadGateway},
+		scriptedResponse{status: http.StatusServiceUnavailable},
+		scriptedResponse{status: http.StatusInternalServerError},
+	)
+	rt, sleeps := newTestRetryTransport(5, time.Now())
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"name":"key"}`))
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{`PUT {"name":"key"}`, `PUT {"name":"key"}`, `PUT {"name":"key"}`, `PUT {"name":"key"}`}, server.requests, "the body should be replayed on every attempt")
+	// Half of each exponentially growing delay is jitter, which is zero here
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}, *sleeps)
+}
+
+func TestRetryTransport_RetriesPostOnlyWhenNotProcessed(t *testing.T) {
+	server := newScriptedServer(t,
+		scriptedResponse{status: http.StatusTooManyRequests},
+		scriptedResponse{status: http.StatusServiceUnavailable},
+	)
+	rt, sleeps := newTestRetryTransport(5, time.Now())
+	client := &http.Client{Transport: rt}
+
+	// A 429 was rejected before the key was created, so it is retried; a 5xx may have come after, so it is not
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"name":"key"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, server.requests, 2)
+	assert.Len(t, *sleeps, 1)
+}
+
+func TestRetryTransport_GivesUp(t *testing.T) {
+	server := newScriptedServer(t,
+		scriptedResponse{status: http.StatusServiceUnavailable},
+		scriptedResponse{status: http.StatusServiceUnavailable},
+		scriptedResponse{status: http.StatusServiceUnavailable},
+	)
+	rt, sleeps := newTestRetryTransport(2, time.Now())
+
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, server.requests, 3)
+	assert.Len(t, *sleeps, 2)
+}
+
+func TestRetryTransport_DoesNotRetryClientErrors(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{status: http.StatusUnprocessableEntity}, scriptedResponse{status: http.StatusNotImplemented})
+	rt, sleeps := newTestRetryTransport(5, time.Now())
+
+	for _, status := range []int{http.StatusUnprocessableEntity, http.StatusNotImplemented} {
+		resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode)
+	}
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetryTransport_HonoursRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := strconv.FormatInt(now.Add(20*time.Second).Unix(), 10)
+	server := newScriptedServer(t,
+		scriptedResponse{status: http.StatusTooManyRequests, header: map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": reset}},
+		scriptedResponse{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "3"}},
+	)
+	rt, sleeps := newTestRetryTransport(5, now)
+
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// The first 429 is retried once the limit resets, the second after the 3s it asks for
+	assert.Equal(t, []time.Duration{20 * time.Second, 3 * time.Second}, *sleeps)
+}
+
+func TestRetryTransport_PausesWhenRateLimitUsedUp(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := newScriptedServer(t, scriptedResponse{status: http.StatusOK, header: map[string]string{
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     strconv.FormatInt(now.Add(45*time.Second).Unix(), 10),
+	}})
+	rt, sleeps := newTestRetryTransport(5, now)
+	client := &http.Client{Transport: rt}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, *sleeps, "the request using up the limit is not delayed")
+
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []time.Duration{45 * time.Second}, *sleeps)
+
+	// Once the reset has passed, requests are sent straight away
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Len(t, *sleeps, 1)
+}
+
+func TestRetryTransport_NetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close() // Every request now fails to connect
+
+	rt, sleeps := newTestRetryTransport(2, time.Now())
+	client := &http.Client{Transport: rt}
+
+	_, err := client.Get(url)
+	assert.Error(t, err)
+	assert.Len(t, *sleeps, 2, "idempotent requests are retried")
+
+	*sleeps = nil
+	_, err = client.Post(url, "application/json", strings.NewReader(`{}`))
+	assert.Error(t, err)
+	assert.Len(t, *sleeps, 2, "a POST that could not connect never reached the server, so it is retried")
+
+	// A connection dropped after the request was sent may follow a committed write
+	requests := 0
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer dropping.Close()
+	*sleeps = nil
+	_, err = client.Post(dropping.URL, "application/json", strings.NewReader(`{}`))
+	assert.Error(t, err)
+	assert.Empty(t, *sleeps, "a POST that may have been processed is not retried")
+	assert.Equal(t, 1, requests)
+}
+
+func TestRetryTransport_StopsWhenContextIsDone(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{status: http.StatusServiceUnavailable})
+	rt := newRetryTransport(nil, 5, time.Hour, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: rt}).Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
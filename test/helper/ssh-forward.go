@@ -0,0 +1,165 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+)
+
+// SshForward is a local TCP port whose connections are forwarded through an SshRunner's host to a remote address,
+// like ssh -L.
+type SshForward struct {
+	LocalAddr  string // Address for clients to connect to, e.g. 127.0.0.1:54321
+	RemoteAddr string // Address the runner's host connects to, e.g. a database's private host:port
+
+	runner   *SshRunner
+	listener net.Listener
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]struct{} // Open connections at both ends
+	wg     sync.WaitGroup
+}
+
+// ForwardE listens on a free local port and forwards each connection to it through the runner's host to
+// remoteAddr (host:port), which need only be reachable from that host. Forwards share the runner's connection
+// and are closed with it.
+//
+// For a service behind a bastion, connect the runner to the bastion:
+//
+//	runner := NewSshRunnerT(t, bastionPublicIP, keyPair, nil)
+//	dbAddr := runner.ForwardT(t, net.JoinHostPort(dbPrivateHost, "25060"))
+func (r *SshRunner) ForwardE(remoteAddr string) (*SshForward, error) {
+	if _, _, err := net.SplitHostPort(remoteAddr); err != nil {
+		return nil, fmt.Errorf("invalid address to forward to: %w", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for forward to %s: %w", remoteAddr, err)
+	}
+	forward := &SshForward{
+		LocalAddr:  listener.Addr().String(),
+		RemoteAddr: remoteAddr,
+		runner:     r,
+		listener:   listener,
+		conns:      map[net.Conn]struct{}{},
+	}
+	r.mu.Lock()
+	r.forwards = append(r.forwards, forward)
+	r.mu.Unlock()
+	log.Printf("Forwarding %s through %s to %s", forward.LocalAddr, r.host, remoteAddr)
+
+	forward.wg.Add(1)
+	go forward.accept()
+	return forward, nil
+}
+
+// ForwardT is like ForwardE but fails the test on error and closes the forward when the test finishes.
+// It returns the local address.
+func (r *SshRunner) ForwardT(t testing.TB, remoteAddr string) string {
+	t.Helper()
+	forward, err := r.ForwardE(remoteAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = forward.Close()
+	})
+	return forward.LocalAddr
+}
+
+// Close stops listening and closes the forward's open connections.
+func (f *SshForward) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.listener.Close()
+	for conn := range f.conns {
+		_ = conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+// accept forwards connections until the listener is closed.
+func (f *SshForward) accept() {
+	defer f.wg.Done()
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Forward %s to %s stopped: %v", f.LocalAddr, f.RemoteAddr, err)
+			}
+			return
+		}
+		f.wg.Add(1)
+		go f.pipe(local)
+	}
+}
+
+// pipe connects local to the remote address and copies between them until either side closes.
+func (f *SshForward) pipe(local net.Conn) {
+	defer f.wg.Done()
+	if !f.track(local) {
+		return
+	}
+	defer f.untrack(local)
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.runner.dialTimeout)
+	remote, err := f.runner.client.DialContext(ctx, "tcp", f.RemoteAddr)
+	cancel()
+	if err != nil {
+		log.Printf("Unable to forward %s through %s to %s: %v", f.LocalAddr, f.runner.host, f.RemoteAddr, err)
+		return
+	}
+	if !f.track(remote) {
+		return
+	}
+	defer f.untrack(remote)
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(remote, local)
+		closeWrite(remote)
+		close(done)
+	}()
+	_, _ = io.Copy(local, remote)
+	closeWrite(local)
+	<-done
+}
+
+// track records conn so Close can close it, or closes it and returns false if the forward is already closed.
+func (f *SshForward) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		_ = conn.Close()
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack closes conn and forgets it.
+func (f *SshForward) untrack(conn net.Conn) {
+	f.mu.Lock()
+	delete(f.conns, conn)
+	f.mu.Unlock()
+	_ = conn.Close()
+}
+
+// closeWrite tells the peer of conn that no more data is coming, while still reading its reply.
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+	}
+}
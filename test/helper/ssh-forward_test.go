@@ -0,0 +1,129 @@
+package helper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTCPServer starts a TCP server that answers each line it receives with name and the line.
+func newTestTCPServer(t *testing.T, name string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					_, _ = fmt.Fprintf(conn, "%s: %s\n", name, scanner.Text())
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// sendLine connects to addr, sends line and returns the reply.
+func sendLine(addr, line string) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestSshRunner_ForwardT(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	bastion := newTestSshServer(t, keyPair.PublicKey())
+	database := newTestTCPServer(t, "database")
+	nfs := newTestTCPServer(t, "nfs")
+
+	runner := NewSshRunnerT(t, bastion.addr, keyPair, nil)
+	databaseAddr := runner.ForwardT(t, database)
+	nfsAddr := runner.ForwardT(t, nfs)
+	assert.NotEqual(t, databaseAddr, nfsAddr)
+
+	// Several connections to each forward at once share the runner's connection
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for _, forward := range []struct{ addr, name string }{{databaseAddr, "database"}, {nfsAddr, "nfs"}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reply, err := sendLine(forward.addr, fmt.Sprintf("ping %d", i))
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("%s: ping %d\n", forward.name, i), reply)
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Len(t, bastion.receivedForwards(), 10)
+	assert.Empty(t, bastion.receivedCommands())
+	assert.Equal(t, "droplet-1\n", runner.RunT(t, "hostname").Stdout, "commands share the connection too")
+}
+
+func TestSshRunner_ForwardE(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	bastion := newTestSshServer(t, keyPair.PublicKey())
+	service := newTestTCPServer(t, "service")
+	runner, err := NewSshRunnerE(bastion.addr, keyPair, nil)
+	require.NoError(t, err)
+
+	_, err = runner.ForwardE("10.10.0.5")
+	assert.ErrorContains(t, err, "invalid address to forward to")
+
+	forward, err := runner.ForwardE(service)
+	require.NoError(t, err)
+	assert.Equal(t, service, forward.RemoteAddr)
+
+	// A connection left open is closed with the forward
+	conn, err := net.Dial("tcp", forward.LocalAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "hello\n")
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "service: hello\n", reply)
+
+	// Closing the runner closes its forwards
+	require.NoError(t, runner.Close())
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	_, err = sendLine(forward.LocalAddr, "hello")
+	assert.Error(t, err)
+	assert.NoError(t, forward.Close(), "closing twice is harmless")
+}
+
+func TestSshRunner_ForwardUnreachable(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	bastion := newTestSshServer(t, keyPair.PublicKey())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	runner := NewSshRunnerT(t, bastion.addr, keyPair, nil)
+	localAddr := runner.ForwardT(t, closedAddr)
+	_, err = sendLine(localAddr, "hello")
+	assert.Error(t, err, "the local connection is closed when the remote address can't be reached")
+	assert.Equal(t, []string{closedAddr}, bastion.receivedForwards())
+}
@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/keygen"
+	"golang.org/x/crypto/ssh"
+)
+
+// SshHostKey is an ed25519 host key generated by the test and installed on its Droplets with cloud-init, so
+// SshRunner can verify it is talking to them instead of accepting any key. The cloud-config comes from the
+// module's Terraform template (see nat-gateway's ssh-host-key.yaml), which TerraformVar feeds.
+type SshHostKey struct {
+	KeyPair *keygen.KeyPair
+
+	// The OpenSSH encoding includes a random check value, so the key is encoded once for every use to match
+	privateKey string
+}
+
+// GenerateSshHostKeyE generates a host key for the Droplets of one test.
+func GenerateSshHostKeyE() (*SshHostKey, error) {
+	keyPair, err := keygen.New("", keygen.WithKeyType(keygen.Ed25519))
+	if err != nil {
+		return nil, fmt.Errorf("error generating SSH host key: %w", err)
+	}
+	return &SshHostKey{KeyPair: keyPair, privateKey: string(keyPair.RawPrivateKey())}, nil
+}
+
+// GenerateSshHostKeyT is like GenerateSshHostKeyE but fails the test on error.
+func GenerateSshHostKeyT(t testing.TB) *SshHostKey {
+	t.Helper()
+	hostKey, err := GenerateSshHostKeyE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hostKey
+}
+
+// GenerateSshHostKey is like GenerateSshHostKeyE but panics on error.
+func GenerateSshHostKey() *SshHostKey {
+	hostKey, err := GenerateSshHostKeyE()
+	if err != nil {
+		log.Panic(err)
+	}
+	return hostKey
+}
+
+// PrivateKey returns the private key in OpenSSH format, as sshd reads it from /etc/ssh/ssh_host_ed25519_key.
+func (k *SshHostKey) PrivateKey() string {
+	return k.privateKey
+}
+
+// PublicKey returns the public key in authorized_keys format, e.g. "ssh-ed25519 AAAA...".
+func (k *SshHostKey) PublicKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.KeyPair.PublicKey())))
+}
+
+// TerraformVar returns the key as the object a module's ssh_host_key variable takes, for terraform.VarInline.
+// terratest passes map values as quoted HCL strings, so the private key's newlines are escaped.
+func (k *SshHostKey) TerraformVar() map[string]string {
+	return map[string]string{
+		"private_key": strings.ReplaceAll(k.PrivateKey(), "\n", `\n`),
+		"public_key":  k.PublicKey(),
+	}
+}
+
+// HostKeyCallback returns a callback for SshRunnerOptions.HostKeyCallback that accepts only this key.
+func (k *SshHostKey) HostKeyCallback() ssh.HostKeyCallback {
+	return ssh.FixedHostKey(k.KeyPair.PublicKey())
+}
@@ -0,0 +1,44 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSshHostKey_TerraformVar(t *testing.T) {
+	hostKey := GenerateSshHostKeyT(t)
+
+	signer, err := ssh.ParsePrivateKey([]byte(hostKey.PrivateKey()))
+	require.NoError(t, err, "the installed private key should be usable by sshd")
+	assert.Equal(t, hostKey.KeyPair.PublicKey().Marshal(), signer.PublicKey().Marshal())
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey.PublicKey()))
+	require.NoError(t, err)
+	assert.Equal(t, ssh.KeyAlgoED25519, publicKey.Type())
+
+	tfVar := hostKey.TerraformVar()
+	assert.NotContains(t, tfVar["private_key"], "\n", "newlines can't appear in a quoted HCL string")
+	assert.Equal(t, hostKey.PrivateKey(), strings.ReplaceAll(tfVar["private_key"], `\n`, "\n"))
+	assert.Equal(t, hostKey.PublicKey(), tfVar["public_key"])
+}
+
+func TestSshHostKey_HostKeyCallback(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	hostKey := GenerateSshHostKeyT(t)
+	bastion := newTestSshServerWithHostKey(t, keyPair.PublicKey(), hostKey.KeyPair.Signer())
+	droplet := newTestSshServerWithHostKey(t, keyPair.PublicKey(), hostKey.KeyPair.Signer())
+	opts := &SshRunnerOptions{JumpHosts: []string{bastion.addr}, HostKeyCallback: hostKey.HostKeyCallback()}
+
+	runner := NewSshRunnerT(t, droplet.addr, keyPair, opts)
+	assert.Equal(t, "droplet-1\n", runner.RunT(t, "hostname").Stdout)
+
+	// A host with any other key is refused, whether it is the jump host or the target
+	impostor := newTestSshServer(t, keyPair.PublicKey())
+	_, err := NewSshRunnerE(droplet.addr, keyPair, &SshRunnerOptions{JumpHosts: []string{impostor.addr}, HostKeyCallback: hostKey.HostKeyCallback()})
+	assert.ErrorContains(t, err, "unable to connect to jump host "+impostor.addr+": ssh: handshake failed: ssh: host key mismatch")
+	_, err = NewSshRunnerE(impostor.addr, keyPair, &SshRunnerOptions{HostKeyCallback: hostKey.HostKeyCallback()})
+	assert.ErrorContains(t, err, "unable to connect to "+impostor.addr+": ssh: handshake failed: ssh: host key mismatch")
+}
@@ -2,53 +2,186 @@ package helper
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/charmbracelet/keygen"
 	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice"
 	"golang.org/x/crypto/ssh"
 	"log"
-	"strings"
+	"net/http"
+	"os"
+	"testing"
 )
 
-func CreateSshKey(client *godo.Client, keyName string) (*keygen.KeyPair, *godo.Key) {
-	log.Printf("Generating SSH key pair: %s", keyName)
-	keyPair, err := keygen.New("")
+// DefaultSshRsaBits is the size of generated RSA keys.
+const DefaultSshRsaBits = 4096
+
+// SshKeyOptions configures the behavior of CreateSshKeyWithOptionsE
+type SshKeyOptions struct {
+	KeyType       keygen.KeyType // keygen.Ed25519 or keygen.RSA (default: keygen.Ed25519)
+	RsaBits       int            // Size of an RSA key (default: DefaultSshRsaBits)
+	PrivateKeyDir string         // Directory to write the private key to (default: not written; t.TempDir() for the T variant)
+}
+
+// SshKey is a generated key pair whose public key has been added to DO.
+type SshKey struct {
+	KeyPair        *keygen.KeyPair
+	Key            *godo.Key
+	PrivateKeyPath string // Private key in OpenSSH format with mode 0600, for tools that need a file, e.g. ssh -i
+}
+
+// CreateSshKeyE generates an ed25519 SSH key pair and adds its public key to DO under keyName.
+// keys is usually godo.Client.Keys.
+func CreateSshKeyE(keys doservice.KeyService, keyName string) (*keygen.KeyPair, *godo.Key, error) {
+	sshKey, err := CreateSshKeyWithOptionsE(keys, keyName, nil)
 	if err != nil {
-		log.Panicf("Error generating SSH key pair: %v", err)
+		return nil, nil, err
 	}
+	return sshKey.KeyPair, sshKey.Key, nil
+}
+
+// CreateSshKeyWithOptionsE generates an SSH key pair configured by opts, which may be nil, and adds its public key
+// to DO under keyName. If opts.PrivateKeyDir is set, the private key is written to a new file there.
+func CreateSshKeyWithOptionsE(keys doservice.KeyService, keyName string, opts *SshKeyOptions) (*SshKey, error) {
+	if opts == nil {
+		opts = &SshKeyOptions{}
+	}
+	keyType := opts.KeyType
+	if keyType == "" {
+		keyType = keygen.Ed25519
+	}
+	rsaBits := opts.RsaBits
+	if rsaBits == 0 {
+		rsaBits = DefaultSshRsaBits
+	}
+	if keyType != keygen.Ed25519 && keyType != keygen.RSA {
+		return nil, fmt.Errorf("unsupported SSH key type %q, expected %q or %q", keyType, keygen.Ed25519, keygen.RSA)
+	}
+
+	log.Printf("Generating %s SSH key pair: %s", keyType, keyName)
+	keyPair, err := keygen.New("", keygen.WithKeyType(keyType), keygen.WithBitSize(rsaBits))
+	if err != nil {
+		return nil, fmt.Errorf("error generating SSH key pair: %w", err)
+	}
+	sshKey := &SshKey{KeyPair: keyPair}
+	if opts.PrivateKeyDir != "" {
+		if sshKey.PrivateKeyPath, err = writePrivateKey(opts.PrivateKeyDir, keyName, keyPair); err != nil {
+			return nil, err
+		}
+	}
+
 	log.Printf("Adding SSH public key to DO: %s", keyName)
 	keyCreateRequest := &godo.KeyCreateRequest{
 		Name:      keyName,
 		PublicKey: string(ssh.MarshalAuthorizedKey(keyPair.PublicKey())),
 	}
 	ctx := context.TODO()
-	key, _, err := client.Keys.Create(ctx, keyCreateRequest)
+	sshKey.Key, _, err = keys.Create(ctx, keyCreateRequest)
+	if err != nil {
+		if sshKey.PrivateKeyPath != "" {
+			_ = os.Remove(sshKey.PrivateKeyPath)
+		}
+		return nil, fmt.Errorf("error adding SSH public key to DO: %w", err)
+	}
+	log.Printf("Added SSH public key to DO: %s (%v)", sshKey.Key.Name, sshKey.Key.ID)
+	return sshKey, nil
+}
+
+// writePrivateKey writes the private key of keyPair to a new file in dir, readable only by its owner.
+func writePrivateKey(dir, keyName string, keyPair *keygen.KeyPair) (string, error) {
+	// CreateTemp creates the file with mode 0600 before anything is written to it
+	f, err := os.CreateTemp(dir, keyName+"-*")
 	if err != nil {
-		log.Panicf("Error adding SSH public key to DO: %v", err)
+		return "", fmt.Errorf("error writing SSH private key: %w", err)
+	}
+	if _, err := f.Write(keyPair.RawPrivateKey()); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("error writing SSH private key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("error writing SSH private key: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// CreateSshKeyT is like CreateSshKeyE but fails the test on error and registers
+// DeleteSshKeyE with t.Cleanup so the key is removed from DO when the test finishes.
+func CreateSshKeyT(t testing.TB, keys doservice.KeyService, keyName string) (*keygen.KeyPair, *godo.Key) {
+	t.Helper()
+	sshKey := CreateSshKeyWithOptionsT(t, keys, keyName, nil)
+	return sshKey.KeyPair, sshKey.Key
+}
+
+// CreateSshKeyWithOptionsT is like CreateSshKeyWithOptionsE but fails the test on error, writes the private key to
+// t.TempDir() unless opts.PrivateKeyDir says otherwise, and registers DeleteSshKeyE with t.Cleanup so the key is
+// removed from DO when the test finishes.
+func CreateSshKeyWithOptionsT(t testing.TB, keys doservice.KeyService, keyName string, opts *SshKeyOptions) *SshKey {
+	t.Helper()
+	withDir := SshKeyOptions{}
+	if opts != nil {
+		withDir = *opts
+	}
+	if withDir.PrivateKeyDir == "" {
+		withDir.PrivateKeyDir = t.TempDir()
+	}
+	sshKey, err := CreateSshKeyWithOptionsE(keys, keyName, &withDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := DeleteSshKeyE(keys, sshKey.Key.ID); err != nil {
+			t.Errorf("Failed to clean up SSH key: %v", err)
+		}
+	})
+	return sshKey
+}
+
+// CreateSshKey is like CreateSshKeyE, using client.Keys, but panics on error.
+func CreateSshKey(client *godo.Client, keyName string) (*keygen.KeyPair, *godo.Key) {
+	keyPair, key, err := CreateSshKeyE(client.Keys, keyName)
+	if err != nil {
+		log.Panic(err)
 	}
-	log.Printf("Added SSH public key to DO: %s (%v)", key.Name, key.ID)
 	return keyPair, key
 }
 
-func DeleteSshKey(client *godo.Client, keyId int) {
+// DeleteSshKeyE removes the SSH key keyId from DO. A key that no longer exists is not an error.
+func DeleteSshKeyE(keys doservice.KeyService, keyId int) error {
 	log.Printf("Deleting SSH key pair from DO: %v", keyId)
 	ctx := context.TODO()
 
 	// First try to fetch the key to see if it exists
-	_, _, err := client.Keys.GetByID(ctx, keyId)
+	_, _, err := keys.GetByID(ctx, keyId)
+	if isNotFound(err) {
+		log.Printf("SSH key with ID %v already deleted or not found", keyId)
+		return nil
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
-			log.Printf("SSH key with ID %v already deleted or not found", keyId)
-			return
-		}
-		log.Printf("Error checking SSH key existence: %v", err)
-		return
+		return fmt.Errorf("error checking SSH key %v exists: %w", keyId, err)
 	}
 
-	// Try to delete the key
-	_, err = client.Keys.DeleteByID(ctx, keyId)
-	if err != nil {
-		log.Printf("Error removing SSH public key from DO: %v", err)
-	} else {
-		log.Printf("Successfully deleted SSH key ID %v", keyId)
+	// Try to delete the key; it may have been deleted since
+	_, err = keys.DeleteByID(ctx, keyId)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("error removing SSH public key %v from DO: %w", keyId, err)
 	}
+	log.Printf("Successfully deleted SSH key ID %v", keyId)
+	return nil
+}
+
+// DeleteSshKey is like DeleteSshKeyE, using client.Keys, but logs errors instead of returning them.
+func DeleteSshKey(client *godo.Client, keyId int) {
+	if err := DeleteSshKeyE(client.Keys, keyId); err != nil {
+		log.Print(err)
+	}
+}
+
+// isNotFound reports whether err is an API error response with a 404 status.
+func isNotFound(err error) bool {
+	var errorResponse *godo.ErrorResponse
+	return errors.As(err, &errorResponse) && errorResponse.Response != nil &&
+		errorResponse.Response.StatusCode == http.StatusNotFound
 }
@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/scale-with-simplicity/test/doservice/doservicefakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCreateSshKeyE(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	keyPair, key, err := CreateSshKeyE(client.Keys, "test-key")
+	require.NoError(t, err)
+
+	keys := server.Keys()
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+	assert.Equal(t, "test-key", keys[0].Name)
+	assert.Equal(t, string(ssh.MarshalAuthorizedKey(keyPair.PublicKey())), keys[0].PublicKey)
+}
+
+func TestDeleteSshKey(t *testing.T) {
+	server, client := newFakeClient(t)
+	_, key, err := CreateSshKeyE(client.Keys, "test-key")
+	require.NoError(t, err)
+
+	DeleteSshKey(client, key.ID)
+	assert.Empty(t, server.Keys())
+
+	// Deleting a key that is already gone only checks for it
+	DeleteSshKey(client, key.ID)
+	requests := server.Requests()
+	assert.NotContains(t, requests[len(requests)-1], "DELETE")
+}
+
+func TestDeleteSshKeyE_LookupFails(t *testing.T) {
+	keys := &doservicefakes.FakeKeyService{}
+	keys.GetByIDReturns(nil, nil, errors.New("connection reset"))
+
+	assert.EqualError(t, DeleteSshKeyE(keys, 42), "error checking SSH key 42 exists: connection reset")
+	_, id := keys.GetByIDArgsForCall(0)
+	assert.Equal(t, 42, id)
+	assert.Zero(t, keys.DeleteByIDCallCount(), "a key that may still exist is not deleted blindly")
+}
+
+func TestCreateSshKeyT_DeletesKeyOnCleanup(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	t.Run("create", func(t *testing.T) {
+		CreateSshKeyT(t, client.Keys, "test-key")
+		assert.Len(t, server.Keys(), 1)
+	})
+	assert.Empty(t, server.Keys())
+}
+
+func TestCreateSshKeyWithOptionsT(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            *SshKeyOptions
+		expectedKeyType string
+	}{
+		{"Default", nil, ssh.KeyAlgoED25519},
+		{"ed25519", &SshKeyOptions{KeyType: keygen.Ed25519}, ssh.KeyAlgoED25519},
+		{"RSA", &SshKeyOptions{KeyType: keygen.RSA, RsaBits: 2048}, ssh.KeyAlgoRSA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newFakeClient(t)
+			sshKey := CreateSshKeyWithOptionsT(t, client.Keys, "test-key", tt.opts)
+
+			assert.Equal(t, tt.expectedKeyType, sshKey.KeyPair.PublicKey().Type())
+			require.Len(t, server.Keys(), 1)
+			assert.Equal(t, string(ssh.MarshalAuthorizedKey(sshKey.KeyPair.PublicKey())), server.Keys()[0].PublicKey)
+
+			info, err := os.Stat(sshKey.PrivateKeyPath)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			data, err := os.ReadFile(sshKey.PrivateKeyPath)
+			require.NoError(t, err)
+			signer, err := ssh.ParsePrivateKey(data)
+			require.NoError(t, err)
+			assert.Equal(t, sshKey.KeyPair.PublicKey().Marshal(), signer.PublicKey().Marshal())
+		})
+	}
+}
+
+func TestCreateSshKeyWithOptionsE(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	_, err := CreateSshKeyWithOptionsE(client.Keys, "test-key", &SshKeyOptions{KeyType: keygen.ECDSA})
+	assert.EqualError(t, err, `unsupported SSH key type "ecdsa", expected "ed25519" or "rsa"`)
+
+	sshKey, err := CreateSshKeyWithOptionsE(client.Keys, "test-key", nil)
+	require.NoError(t, err)
+	assert.Empty(t, sshKey.PrivateKeyPath, "the private key is only written when asked")
+
+	// The private key isn't left behind when the public key can't be added
+	dir := t.TempDir()
+	keys := &doservicefakes.FakeKeyService{}
+	keys.CreateReturns(nil, nil, errors.New("quota exceeded"))
+	_, err = CreateSshKeyWithOptionsE(keys, "test-key", &SshKeyOptions{PrivateKeyDir: dir})
+	assert.ErrorContains(t, err, "quota exceeded")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Len(t, server.Keys(), 1)
+}
+
+// apiError returns the error godo returns for a response with status
+func apiError(status int, message string) error {
+	return &godo.ErrorResponse{Response: &http.Response{StatusCode: status, Request: &http.Request{}}, Message: message}
+}
+
+func TestDeleteSshKeyE(t *testing.T) {
+	tests := []struct {
+		name            string
+		getErr          error
+		deleteErr       error
+		expectedDeletes int
+		expectedErr     string
+	}{
+		{"Deleted", nil, nil, 1, ""},
+		{"Already gone", apiError(http.StatusNotFound, "The resource you were accessing could not be found."), nil, 0, ""},
+		{"Gone before the delete", nil, apiError(http.StatusNotFound, "not found"), 1, ""},
+		// A message mentioning 404 doesn't mean the key is gone
+		{"Server error", apiError(http.StatusInternalServerError, "upstream returned 404"), nil, 0, "error checking SSH key 42 exists"},
+		{"Delete fails", nil, apiError(http.StatusForbidden, "forbidden"), 1, "error removing SSH public key 42 from DO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &doservicefakes.FakeKeyService{}
+			keys.GetByIDReturns(&godo.Key{ID: 42}, nil, tt.getErr)
+			keys.DeleteByIDReturns(nil, tt.deleteErr)
+
+			err := DeleteSshKeyE(keys, 42)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+			assert.Equal(t, tt.expectedDeletes, keys.DeleteByIDCallCount())
+		})
+	}
+}
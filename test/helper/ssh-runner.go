@@ -0,0 +1,282 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultSshUser is the user created on DigitalOcean Droplets.
+	DefaultSshUser = "root"
+	// DefaultSshDialTimeout limits connecting to and authenticating with each host.
+	DefaultSshDialTimeout = 30 * time.Second
+	// DefaultSshCommandTimeout limits each command run with SshRunner.
+	DefaultSshCommandTimeout = 5 * time.Minute
+	// sshKillGracePeriod is how long a timed out command is given to exit after being killed.
+	sshKillGracePeriod = 5 * time.Second
+)
+
+// SshRunnerOptions configures the behavior of NewSshRunnerE
+type SshRunnerOptions struct {
+	User            string              // User on every host (default: DefaultSshUser)
+	JumpHosts       []string            // Bastions to connect through in order, like ssh -J, as host or host:port
+	HostKeyCallback ssh.HostKeyCallback // Verifies every host's key (default: accept any key)
+	DialTimeout     time.Duration       // Limit on connecting to each host (default: DefaultSshDialTimeout)
+	CommandTimeout  time.Duration       // Limit on each command, unless its context ends sooner (default: DefaultSshCommandTimeout)
+}
+
+// SshResult contains the output of a command run with SshRunner
+type SshResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// SshRunner runs commands on a host over SSH, possibly through jump hosts, forwards local ports through it
+// (see ForwardE) and transfers files with SFTP (see UploadE), using one connection for all of them.
+type SshRunner struct {
+	host           string
+	client         *ssh.Client
+	jumps          []*ssh.Client // Connections to the jump hosts, outermost first
+	commandTimeout time.Duration
+	dialTimeout    time.Duration
+
+	mu       sync.Mutex
+	forwards []*SshForward
+	sftp     *sftp.Client // Started by the first file transfer
+}
+
+// NewSshRunnerE connects to host (host or host:port) as opts.User, authenticating with keyPair on the host and
+// every jump host. opts may be nil. Host keys are not verified unless opts.HostKeyCallback is set, since test
+// Droplets get new keys every run. Close the runner when done with it.
+func NewSshRunnerE(host string, keyPair *keygen.KeyPair, opts *SshRunnerOptions) (*SshRunner, error) {
+	if opts == nil {
+		opts = &SshRunnerOptions{}
+	}
+	user := opts.User
+	if user == "" {
+		user = DefaultSshUser
+	}
+	hostKeyCallback := opts.HostKeyCallback
+	if hostKeyCallback == nil {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+	dialTimeout := opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = DefaultSshDialTimeout
+	}
+	commandTimeout := opts.CommandTimeout
+	if commandTimeout <= 0 {
+		commandTimeout = DefaultSshCommandTimeout
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(keyPair.Signer())},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	runner := &SshRunner{host: host, commandTimeout: commandTimeout, dialTimeout: dialTimeout}
+	var via *ssh.Client
+	for _, jumpHost := range opts.JumpHosts {
+		jump, err := dialSsh(via, jumpHost, config, dialTimeout)
+		if err != nil {
+			_ = runner.Close()
+			return nil, fmt.Errorf("unable to connect to jump host %s: %w", jumpHost, err)
+		}
+		runner.jumps = append(runner.jumps, jump)
+		via = jump
+	}
+	client, err := dialSsh(via, host, config, dialTimeout)
+	if err != nil {
+		_ = runner.Close()
+		return nil, fmt.Errorf("unable to connect to %s: %w", host, err)
+	}
+	runner.client = client
+	return runner, nil
+}
+
+// NewSshRunnerT is like NewSshRunnerE but fails the test on error and closes the runner when the test finishes.
+func NewSshRunnerT(t testing.TB, host string, keyPair *keygen.KeyPair, opts *SshRunnerOptions) *SshRunner {
+	t.Helper()
+	runner, err := NewSshRunnerE(host, keyPair, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = runner.Close()
+	})
+	return runner
+}
+
+// NewSshRunner is like NewSshRunnerE but panics on error.
+func NewSshRunner(host string, keyPair *keygen.KeyPair, opts *SshRunnerOptions) *SshRunner {
+	runner, err := NewSshRunnerE(host, keyPair, opts)
+	if err != nil {
+		log.Panic(err)
+	}
+	return runner
+}
+
+// RunE runs command and returns its output and exit code. A command that exits with a non-zero status returns
+// both its result and an error. A command still running when ctx ends or the command timeout passes is killed.
+func (r *SshRunner) RunE(ctx context.Context, command string) (*SshResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.commandTimeout)
+	defer cancel()
+
+	session, err := r.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open SSH session on %s: %w", r.host, err)
+	}
+	defer session.Close()
+	var stdout, stderr syncBuffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Start(command); err != nil {
+		return nil, fmt.Errorf("unable to start %q on %s: %w", command, r.host, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		select {
+		case <-done:
+		case <-time.After(sshKillGracePeriod):
+		}
+		result := &SshResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: -1}
+		return result, fmt.Errorf("command %q on %s did not finish: %w", command, r.host, ctx.Err())
+	}
+
+	result := &SshResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return result, nil
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+		return result, fmt.Errorf("command %q on %s exited with status %d: %s", command, r.host, result.ExitCode, strings.TrimSpace(result.Stderr))
+	default:
+		result.ExitCode = -1
+		return result, fmt.Errorf("command %q on %s failed: %w", command, r.host, err)
+	}
+}
+
+// RunT is like RunE but fails the test on error.
+func (r *SshRunner) RunT(t testing.TB, command string) *SshResult {
+	t.Helper()
+	result, err := r.RunE(context.Background(), command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// Run is like RunE but panics on error.
+func (r *SshRunner) Run(command string) *SshResult {
+	result, err := r.RunE(context.Background(), command)
+	if err != nil {
+		log.Panic(err)
+	}
+	return result
+}
+
+// Close closes the runner's forwards and SFTP client, the connection to the host and then those to the jump hosts.
+func (r *SshRunner) Close() error {
+	r.mu.Lock()
+	forwards := r.forwards
+	r.forwards = nil
+	sftpClient := r.sftp
+	r.sftp = nil
+	r.mu.Unlock()
+	var errs []error
+	for _, forward := range forwards {
+		errs = append(errs, forward.Close())
+	}
+	if sftpClient != nil {
+		errs = append(errs, sftpClient.Close())
+	}
+	if r.client != nil {
+		errs = append(errs, r.client.Close())
+	}
+	for i := len(r.jumps) - 1; i >= 0; i-- {
+		errs = append(errs, r.jumps[i].Close())
+	}
+	return errors.Join(errs...)
+}
+
+// dialSsh connects to addr, through via if it isn't nil, and authenticates, all within timeout.
+func dialSsh(via *ssh.Client, addr string, config *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	addr = sshAddress(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if via == nil {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = via.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Connections through a jump host don't support deadlines, so a stalled handshake is ended by closing it
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !stop() {
+		if err == nil {
+			_ = c.Close()
+		}
+		return nil, fmt.Errorf("SSH handshake did not finish: %w", ctx.Err())
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshAddress adds the default SSH port to host if it has none.
+func sshAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "22")
+}
+
+// syncBuffer is a bytes.Buffer that can be read while a session is still writing to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
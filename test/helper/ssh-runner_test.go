@@ -0,0 +1,304 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSshServer is an in-process SSH server accepting one key for root. It runs exec requests with its exec
+// function, serves SFTP from the local file system, and forwards direct-tcpip channels, so it can act as a bastion.
+type testSshServer struct {
+	addr    string
+	hostKey ssh.Signer
+	exec    func(command string, stdout, stderr io.Writer, stop <-chan struct{}) uint32
+	sftpDir string // Working directory of SFTP sessions
+
+	mu       sync.Mutex
+	commands []string // Commands received
+	forwards []string // Addresses direct-tcpip channels were opened to
+}
+
+// newTestSshServer starts a testSshServer that accepts authorizedKey and runs commands with testSshExec.
+func newTestSshServer(t *testing.T, authorizedKey ssh.PublicKey) *testSshServer {
+	return newTestSshServerWithHostKey(t, authorizedKey, newTestKeyPair(t).Signer())
+}
+
+// newTestSshServerWithHostKey is like newTestSshServer but identifies itself with hostKey.
+func newTestSshServerWithHostKey(t *testing.T, authorizedKey ssh.PublicKey, hostKey ssh.Signer) *testSshServer {
+	s := &testSshServer{hostKey: hostKey, exec: testSshExec, sftpDir: t.TempDir()}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == DefaultSshUser && bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s.addr = listener.Addr().String()
+	var conns sync.WaitGroup
+	t.Cleanup(func() {
+		_ = listener.Close()
+		conns.Wait()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				s.serve(conn, config)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *testSshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.session(newChannel)
+		case "direct-tcpip":
+			go s.forward(newChannel)
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// session runs the command of the first exec request, or serves SFTP for an sftp subsystem request. A command
+// is stopped when the client signals or closes the channel.
+func (s *testSshServer) session(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	exec := make(chan string, 1)
+	subsystem := make(chan struct{}, 1)
+	go func() {
+		defer stopOnce.Do(func() { close(stop) })
+		for req := range requests {
+			switch req.Type {
+			case "exec":
+				var payload struct{ Command string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(true, nil)
+				exec <- payload.Command
+			case "subsystem":
+				var payload struct{ Name string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(payload.Name == "sftp", nil)
+				if payload.Name == "sftp" {
+					subsystem <- struct{}{}
+				}
+			case "signal":
+				stopOnce.Do(func() { close(stop) })
+			default:
+				_ = req.Reply(false, nil)
+			}
+		}
+	}()
+
+	var command string
+	select {
+	case command = <-exec:
+	case <-subsystem:
+		server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.sftpDir))
+		if err == nil {
+			_ = server.Serve()
+		}
+		return
+	case <-stop:
+		return
+	}
+	s.mu.Lock()
+	s.commands = append(s.commands, command)
+	s.mu.Unlock()
+	status := s.exec(command, channel, channel.Stderr(), stop)
+	_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+// forward connects a direct-tcpip channel to the address it asks for.
+func (s *testSshServer) forward(newChannel ssh.NewChannel) {
+	var payload struct {
+		DestAddr   string
+		DestPort   uint32
+		OriginAddr string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(payload.DestAddr, strconv.Itoa(int(payload.DestPort)))
+	s.mu.Lock()
+	s.forwards = append(s.forwards, addr)
+	s.mu.Unlock()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		_ = channel.CloseWrite()
+	}()
+	_, _ = io.Copy(conn, channel)
+	_ = conn.Close()
+	_ = channel.Close()
+}
+
+func (s *testSshServer) receivedCommands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *testSshServer) receivedForwards() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwards...)
+}
+
+// testSshExec understands a few commands: "hostname", "fail", which exits 3, and "sleep", which runs until stopped.
+func testSshExec(command string, stdout, stderr io.Writer, stop <-chan struct{}) uint32 {
+	switch command {
+	case "hostname":
+		_, _ = io.WriteString(stdout, "droplet-1\n")
+		return 0
+	case "fail":
+		_, _ = io.WriteString(stdout, "partial output\n")
+		_, _ = io.WriteString(stderr, "something broke\n")
+		return 3
+	case "sleep":
+		_, _ = io.WriteString(stdout, "started\n")
+		select {
+		case <-stop:
+		case <-time.After(time.Minute):
+		}
+		return 137
+	}
+	_, _ = fmt.Fprintf(stderr, "%s: command not found\n", command)
+	return 127
+}
+
+func newTestKeyPair(t *testing.T) *keygen.KeyPair {
+	keyPair, err := keygen.New("", keygen.WithKeyType(keygen.Ed25519))
+	require.NoError(t, err)
+	return keyPair
+}
+
+func TestSshRunner_RunE(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	server := newTestSshServer(t, keyPair.PublicKey())
+	runner := NewSshRunnerT(t, server.addr, keyPair, nil)
+
+	result := runner.RunT(t, "hostname")
+	assert.Equal(t, &SshResult{Stdout: "droplet-1\n"}, result)
+
+	result, err := runner.RunE(context.Background(), "fail")
+	assert.EqualError(t, err, fmt.Sprintf(`command "fail" on %s exited with status 3: something broke`, server.addr))
+	assert.Equal(t, &SshResult{Stdout: "partial output\n", Stderr: "something broke\n", ExitCode: 3}, result)
+
+	assert.Equal(t, []string{"hostname", "fail"}, server.receivedCommands(), "commands should share one connection")
+}
+
+func TestSshRunner_JumpHosts(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	bastion := newTestSshServer(t, keyPair.PublicKey())
+	innerBastion := newTestSshServer(t, keyPair.PublicKey())
+	droplet := newTestSshServer(t, keyPair.PublicKey())
+
+	runner := NewSshRunnerT(t, droplet.addr, keyPair, &SshRunnerOptions{JumpHosts: []string{bastion.addr, innerBastion.addr}})
+	assert.Equal(t, "droplet-1\n", runner.RunT(t, "hostname").Stdout)
+
+	assert.Equal(t, []string{innerBastion.addr}, bastion.receivedForwards())
+	assert.Equal(t, []string{droplet.addr}, innerBastion.receivedForwards())
+	assert.Empty(t, bastion.receivedCommands())
+	assert.Empty(t, innerBastion.receivedCommands())
+	assert.Equal(t, []string{"hostname"}, droplet.receivedCommands())
+}
+
+func TestSshRunner_CommandTimeout(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	server := newTestSshServer(t, keyPair.PublicKey())
+	runner := NewSshRunnerT(t, server.addr, keyPair, &SshRunnerOptions{CommandTimeout: 200 * time.Millisecond})
+
+	start := time.Now()
+	result, err := runner.RunE(context.Background(), "sleep")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, -1, result.ExitCode)
+
+	// The connection is still usable, and a context can end a command sooner
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = runner.RunE(ctx, "sleep")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "droplet-1\n", runner.RunT(t, "hostname").Stdout)
+}
+
+func TestNewSshRunnerE_Errors(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	bastion := newTestSshServer(t, keyPair.PublicKey())
+
+	_, err := NewSshRunnerE(bastion.addr, newTestKeyPair(t), nil)
+	assert.ErrorContains(t, err, "unable to connect to "+bastion.addr+": ssh: handshake failed")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	_, err = NewSshRunnerE(closedAddr, keyPair, &SshRunnerOptions{JumpHosts: []string{bastion.addr}})
+	assert.ErrorContains(t, err, "unable to connect to "+closedAddr)
+	assert.Equal(t, []string{closedAddr}, bastion.receivedForwards())
+
+	// A server that accepts connections but never completes the handshake
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer stalled.Close()
+	_, err = NewSshRunnerE(stalled.Addr().String(), keyPair, &SshRunnerOptions{DialTimeout: 200 * time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSshAddress(t *testing.T) {
+	assert.Equal(t, "10.0.0.5:22", sshAddress("10.0.0.5"))
+	assert.Equal(t, "10.0.0.5:2222", sshAddress("10.0.0.5:2222"))
+	assert.Equal(t, "[fd00::5]:22", sshAddress("fd00::5"))
+}
@@ -0,0 +1,165 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// sftpClientE returns the runner's SFTP client, starting it on the runner's connection the first time.
+func (r *SshRunner) sftpClientE() (*sftp.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sftp == nil {
+		client, err := sftp.NewClient(r.client)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start SFTP on %s: %w", r.host, err)
+		}
+		r.sftp = client
+	}
+	return r.sftp, nil
+}
+
+// UploadE copies the local file localPath to remotePath on the runner's host, keeping its permissions and
+// creating any missing parent directories. Like the rest of the runner, it goes through the jump hosts.
+func (r *SshRunner) UploadE(localPath, remotePath string) error {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %w", localPath, err)
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %w", localPath, err)
+	}
+	return r.upload(local, remotePath, info.Mode().Perm())
+}
+
+// UploadT is like UploadE but fails the test on error.
+func (r *SshRunner) UploadT(t testing.TB, localPath, remotePath string) {
+	t.Helper()
+	if err := r.UploadE(localPath, remotePath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// WriteFileE writes data to remotePath on the runner's host with permissions mode, creating any missing parent
+// directories, e.g. to push a probe script with mode 0755 and run it.
+func (r *SshRunner) WriteFileE(remotePath string, data []byte, mode os.FileMode) error {
+	return r.upload(bytes.NewReader(data), remotePath, mode)
+}
+
+// WriteFileT is like WriteFileE but fails the test on error.
+func (r *SshRunner) WriteFileT(t testing.TB, remotePath string, data []byte, mode os.FileMode) {
+	t.Helper()
+	if err := r.WriteFileE(remotePath, data, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// DownloadE copies remotePath on the runner's host to the local file localPath, keeping its permissions and
+// creating any missing parent directories, e.g. to keep a packet capture as a test artifact.
+func (r *SshRunner) DownloadE(remotePath, localPath string) error {
+	client, err := r.sftpClientE()
+	if err != nil {
+		return err
+	}
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("unable to download %s from %s: %w", remotePath, r.host, err)
+	}
+	defer remote.Close()
+	info, err := remote.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to download %s from %s: %w", remotePath, r.host, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("unable to download %s from %s: %w", remotePath, r.host, err)
+	}
+	local, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("unable to download %s from %s: %w", remotePath, r.host, err)
+	}
+	n, err := remote.WriteTo(local)
+	if closeErr := local.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to download %s from %s: %w", remotePath, r.host, err)
+	}
+	log.Printf("Downloaded %s from %s to %s (%d bytes)", remotePath, r.host, localPath, n)
+	return nil
+}
+
+// DownloadT is like DownloadE but fails the test on error.
+func (r *SshRunner) DownloadT(t testing.TB, remotePath, localPath string) {
+	t.Helper()
+	if err := r.DownloadE(remotePath, localPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ReadFileE returns the contents of remotePath on the runner's host, e.g. a generated config to check.
+func (r *SshRunner) ReadFileE(remotePath string) ([]byte, error) {
+	client, err := r.sftpClientE()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s on %s: %w", remotePath, r.host, err)
+	}
+	defer remote.Close()
+	data, err := io.ReadAll(remote)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s on %s: %w", remotePath, r.host, err)
+	}
+	return data, nil
+}
+
+// ReadFileT is like ReadFileE but fails the test on error.
+func (r *SshRunner) ReadFileT(t testing.TB, remotePath string) []byte {
+	t.Helper()
+	data, err := r.ReadFileE(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// upload writes everything read from src to remotePath with permissions mode.
+func (r *SshRunner) upload(src io.Reader, remotePath string, mode os.FileMode) error {
+	client, err := r.sftpClientE()
+	if err != nil {
+		return err
+	}
+	// SFTP paths are always slash-separated, whatever the local OS
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("unable to upload to %s on %s: %w", remotePath, r.host, err)
+	}
+	remote, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("unable to upload to %s on %s: %w", remotePath, r.host, err)
+	}
+	n, err := remote.ReadFrom(src)
+	if err == nil {
+		// Set explicitly, since the file may already exist or the remote umask may mask bits
+		err = remote.Chmod(mode)
+	}
+	if closeErr := remote.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to upload to %s on %s: %w", remotePath, r.host, err)
+	}
+	log.Printf("Uploaded %d bytes to %s on %s", n, remotePath, r.host)
+	return nil
+}
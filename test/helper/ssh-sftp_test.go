@@ -0,0 +1,81 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSshRunner_FileTransfer(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	bastion := newTestSshServer(t, keyPair.PublicKey())
+	droplet := newTestSshServer(t, keyPair.PublicKey())
+	runner := NewSshRunnerT(t, droplet.addr, keyPair, &SshRunnerOptions{JumpHosts: []string{bastion.addr}})
+
+	// A script written from memory, into a directory that doesn't exist yet
+	probe := []byte("#!/bin/sh\ncurl -s --max-time 10 ifconfig.me\n")
+	runner.WriteFileT(t, "probes/egress.sh", probe, 0755)
+	data, err := os.ReadFile(filepath.Join(droplet.sftpDir, "probes", "egress.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, probe, data)
+	info, err := os.Stat(filepath.Join(droplet.sftpDir, "probes", "egress.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// A local file larger than one SFTP packet, to an absolute path
+	localDir := t.TempDir()
+	config := make([]byte, 200_000)
+	for i := range config {
+		config[i] = byte('a' + i%26)
+	}
+	configPath := filepath.Join(localDir, "ipsec.conf")
+	require.NoError(t, os.WriteFile(configPath, config, 0600))
+	remoteConfigPath := filepath.Join(droplet.sftpDir, "etc", "ipsec.conf")
+	runner.UploadT(t, configPath, remoteConfigPath)
+	info, err = os.Stat(remoteConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the local file's permissions are kept")
+	assert.Equal(t, config, runner.ReadFileT(t, remoteConfigPath))
+
+	// Overwriting replaces the whole file
+	runner.WriteFileT(t, remoteConfigPath, []byte("conn short\n"), 0644)
+	assert.Equal(t, "conn short\n", string(runner.ReadFileT(t, remoteConfigPath)))
+
+	downloadPath := filepath.Join(localDir, "artifacts", "capture.pcap")
+	require.NoError(t, os.WriteFile(filepath.Join(droplet.sftpDir, "capture.pcap"), config, 0640))
+	runner.DownloadT(t, "capture.pcap", downloadPath)
+	data, err = os.ReadFile(downloadPath)
+	require.NoError(t, err)
+	assert.Equal(t, config, data)
+	info, err = os.Stat(downloadPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	assert.Empty(t, bastion.receivedCommands(), "file transfers go through the jump host")
+	assert.Empty(t, droplet.receivedCommands(), "file transfers need no shell commands")
+}
+
+func TestSshRunner_FileTransferErrors(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	droplet := newTestSshServer(t, keyPair.PublicKey())
+	runner := NewSshRunnerT(t, droplet.addr, keyPair, nil)
+
+	_, err := runner.ReadFileE("missing.txt")
+	assert.ErrorContains(t, err, "unable to read missing.txt on "+droplet.addr)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = runner.DownloadE("missing.txt", filepath.Join(t.TempDir(), "missing.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = runner.UploadE(filepath.Join(t.TempDir(), "missing.txt"), "missing.txt")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// The SFTP session is reused after errors and closed with the runner
+	runner.WriteFileT(t, "ok.txt", []byte("ok"), 0644)
+	require.NoError(t, runner.Close())
+	_, err = runner.ReadFileE("ok.txt")
+	assert.Error(t, err)
+}
@@ -1,13 +1,15 @@
 package helper
 
 import (
+	"fmt"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"strings"
 	"testing"
 	"time"
 )
 
-func TerraformDestroyVpcWithMembers(t *testing.T, terraformOptions *terraform.Options) {
+// TerraformDestroyVpcWithMembersE runs terraform destroy, retrying while DO still reports members in the VPC.
+func TerraformDestroyVpcWithMembersE(t testing.TB, terraformOptions *terraform.Options) error {
 	const (
 		maxRetries = 5
 		retryDelay = 30 * time.Second
@@ -20,7 +22,7 @@ func TerraformDestroyVpcWithMembers(t *testing.T, terraformOptions *terraform.Op
 		_, err := terraform.DestroyE(t, terraformOptions)
 		if err == nil {
 			t.Log("Terraform destroy succeeded")
-			return
+			return nil
 		}
 
 		// Check for the VPC-with-members error
@@ -31,10 +33,19 @@ func TerraformDestroyVpcWithMembers(t *testing.T, terraformOptions *terraform.Op
 				continue
 			}
 			// last attempt and still failing
-			t.Fatalf("VPC still has members after %d attempts: %v", maxRetries, err)
+			return fmt.Errorf("VPC still has members after %d attempts: %w", maxRetries, err)
 		}
 
 		// any other error should stop immediately
-		t.Fatalf("Failed to destroy resources: %v", err)
+		return fmt.Errorf("failed to destroy resources: %w", err)
+	}
+	return nil
+}
+
+// TerraformDestroyVpcWithMembers is like TerraformDestroyVpcWithMembersE but fails the test on error.
+func TerraformDestroyVpcWithMembers(t testing.TB, terraformOptions *terraform.Options) {
+	t.Helper()
+	if err := TerraformDestroyVpcWithMembersE(t, terraformOptions); err != nil {
+		t.Fatal(err)
 	}
 }
@@ -0,0 +1,134 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// TunnelAddressPool is the link-local range tunnel subnets are allocated from.
+const TunnelAddressPool = "169.254.0.0/16"
+
+// AwsReservedTunnelCidrs are the link-local blocks AWS Site-to-Site VPN does not accept as tunnel inside CIDRs.
+var AwsReservedTunnelCidrs = []string{
+	"169.254.0.0/30",
+	"169.254.1.0/30",
+	"169.254.2.0/30",
+	"169.254.3.0/30",
+	"169.254.4.0/30",
+	"169.254.5.0/30",
+	"169.254.169.252/30", // Includes the instance metadata service
+}
+
+// TunnelAddressPair is a point-to-point subnet for an IPsec tunnel or BGP session, and the address each end uses.
+type TunnelAddressPair struct {
+	Cidr         string // Tunnel subnet, e.g. "169.254.10.0/30"
+	PrefixLength int    // 30 or 29
+	LocalIP      string // First usable address, used on the DigitalOcean side, e.g. "169.254.10.1"
+	RemoteIP     string // Last usable address, used on the remote side, e.g. "169.254.10.2"
+}
+
+// LocalCidr returns LocalIP with the tunnel's prefix length, e.g. "169.254.0.1/29" for do_local_router_ip.
+func (p *TunnelAddressPair) LocalCidr() string {
+	return fmt.Sprintf("%s/%d", p.LocalIP, p.PrefixLength)
+}
+
+// RemoteCidr returns RemoteIP with the tunnel's prefix length, e.g. "169.254.0.6/29" for do_peer_router_ip.
+func (p *TunnelAddressPair) RemoteCidr() string {
+	return fmt.Sprintf("%s/%d", p.RemoteIP, p.PrefixLength)
+}
+
+// TunnelAddressAssigner hands out non-overlapping /30 and /29 tunnel subnets from link-local space,
+// skipping AwsReservedTunnelCidrs. Like CidrAssigner, it is safe for concurrent use and can share
+// a lease store with other processes so parallel VPN tests never share a tunnel subnet.
+type TunnelAddressAssigner struct {
+	cidrs *CidrAssigner
+	pool  *cidrPool
+}
+
+// TunnelAddressAssignerOptions configures the behavior of NewTunnelAddressAssignerWithOptions
+type TunnelAddressAssignerOptions struct {
+	ExcludedCidrs []string       // Extra link-local ranges to avoid, e.g. tunnels hard-coded in Terraform
+	LeaseStore    CidrLeaseStore // Shared ledger every subnet must be leased from, e.g. CidrLeaseStoreFromEnv() (default: none, in-memory tracking only)
+	LeaseOwner    string         // Owner recorded on leases (default: DefaultCidrLeaseOwner())
+	LeaseTTL      time.Duration  // How long leases are held before expiring (default: DefaultCidrLeaseTTL)
+	PlacementSeed string         // Hashed to where each search starts, e.g. t.Name() (default: none)
+}
+
+// NewTunnelAddressAssigner creates a new TunnelAddressAssigner.
+func NewTunnelAddressAssigner(ctx context.Context) *TunnelAddressAssigner {
+	return NewTunnelAddressAssignerWithOptions(ctx, nil)
+}
+
+// NewTunnelAddressAssignerWithOptions creates a new TunnelAddressAssigner configured by opts, which may be nil.
+func NewTunnelAddressAssignerWithOptions(ctx context.Context, opts *TunnelAddressAssignerOptions) *TunnelAddressAssigner {
+	cidrOpts := &CidrAssignerOptions{
+		Sources:             []CidrSource{NewStaticCidrSource("aws-reserved-tunnel", AwsReservedTunnelCidrs...)},
+		IgnoreReservedCidrs: true, // DigitalOceanReservedCidrs covers the whole link-local range
+	}
+	if opts != nil {
+		cidrOpts.ExcludedCidrs = opts.ExcludedCidrs
+		cidrOpts.LeaseStore = opts.LeaseStore
+		cidrOpts.LeaseOwner = opts.LeaseOwner
+		cidrOpts.LeaseTTL = opts.LeaseTTL
+		cidrOpts.PlacementSeed = opts.PlacementSeed
+	}
+	return &TunnelAddressAssigner{
+		cidrs: NewCidrAssignerWithOptions(ctx, nil, cidrOpts),
+		pool:  newCidrPool(netip.MustParsePrefix(TunnelAddressPool)),
+	}
+}
+
+// GetTunnelPairE returns a free tunnel subnet with a prefix length of 30 (AWS VPN, ipsec-gateway) or 29 (Partner Network Connect).
+func (a *TunnelAddressAssigner) GetTunnelPairE(prefixLength int) (*TunnelAddressPair, error) {
+	if prefixLength != 29 && prefixLength != 30 {
+		return nil, fmt.Errorf("tunnel prefix length must be 29 or 30, got %d", prefixLength)
+	}
+	cidrs, err := a.cidrs.allocate(a.pool, netip.Addr{}, []int{prefixLength})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tunnel addresses: %w", err)
+	}
+
+	block := prefixRange(netip.MustParsePrefix(cidrs[0]))
+	return &TunnelAddressPair{
+		Cidr:         cidrs[0],
+		PrefixLength: prefixLength,
+		LocalIP:      addrFromUint128(block.first.addOne(), 32).String(),
+		RemoteIP:     addrFromUint128(block.last.subOne(), 32).String(),
+	}, nil
+}
+
+// GetTunnelPairT is like GetTunnelPairE but fails the test if a tunnel subnet cannot be assigned.
+// The subnet is released when the test finishes, unless the test failed.
+func (a *TunnelAddressAssigner) GetTunnelPairT(t testing.TB, prefixLength int) *TunnelAddressPair {
+	t.Helper()
+	pair, err := a.GetTunnelPairE(prefixLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.cidrs.releaseOnCleanup(t, pair.Cidr)
+	return pair
+}
+
+// GetTunnelPair returns a free tunnel subnet with a prefix length of 30 or 29.
+// It will fatal the test if a tunnel subnet cannot be assigned.
+func (a *TunnelAddressAssigner) GetTunnelPair(prefixLength int) *TunnelAddressPair {
+	pair, err := a.GetTunnelPairE(prefixLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return pair
+}
+
+// Release returns the tunnel subnet cidr (TunnelAddressPair.Cidr) to the pool.
+func (a *TunnelAddressAssigner) Release(cidr string) error {
+	return a.cidrs.Release(cidr)
+}
+
+// Allocations returns the tunnel subnets this assigner has handed out that have not been released or expired.
+func (a *TunnelAddressAssigner) Allocations() []CidrAllocation {
+	return a.cidrs.Allocations()
+}
@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTunnelAddressAssigner_GetTunnelPair(t *testing.T) {
+	// The environment's lease store is only used when it is passed in, so these leases never reach it
+	leaseFile := filepath.Join(t.TempDir(), "leases.json")
+	t.Setenv("CIDR_LEASE_URL", "")
+	t.Setenv("CIDR_LEASE_FILE", leaseFile)
+	assigner := NewTunnelAddressAssigner(context.Background())
+
+	pair, err := assigner.GetTunnelPairE(30)
+	require.NoError(t, err)
+	assert.Equal(t, &TunnelAddressPair{Cidr: "169.254.0.4/30", PrefixLength: 30, LocalIP: "169.254.0.5", RemoteIP: "169.254.0.6"}, pair)
+
+	pair, err = assigner.GetTunnelPairE(29)
+	require.NoError(t, err)
+	assert.Equal(t, &TunnelAddressPair{Cidr: "169.254.0.8/29", PrefixLength: 29, LocalIP: "169.254.0.9", RemoteIP: "169.254.0.14"}, pair)
+	assert.Equal(t, "169.254.0.9/29", pair.LocalCidr())
+	assert.Equal(t, "169.254.0.14/29", pair.RemoteCidr())
+
+	_, err = assigner.GetTunnelPairE(24)
+	assert.EqualError(t, err, "tunnel prefix length must be 29 or 30, got 24")
+	assert.NoFileExists(t, leaseFile)
+}
+
+func TestTunnelAddressAssigner_SkipsAwsReservedBlocks(t *testing.T) {
+	// Leave 169.254.169.252/30 as the lowest free /30, so the next one should be used instead
+	assigner := NewTunnelAddressAssignerWithOptions(context.Background(), &TunnelAddressAssignerOptions{
+		ExcludedCidrs: []string{
+			"169.254.0.0/17", "169.254.128.0/19", "169.254.160.0/21", "169.254.168.0/24",
+			"169.254.169.0/25", "169.254.169.128/26", "169.254.169.192/27", "169.254.169.224/28",
+			"169.254.169.240/29", "169.254.169.248/30",
+		},
+	})
+
+	pair, err := assigner.GetTunnelPairE(30)
+	require.NoError(t, err)
+	assert.Equal(t, "169.254.170.0/30", pair.Cidr)
+}
+
+func TestTunnelAddressAssigner_SharedLeaseStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leases.json")
+	first := NewTunnelAddressAssignerWithOptions(context.Background(), &TunnelAddressAssignerOptions{LeaseStore: NewFileCidrLeaseStore(path)})
+	second := NewTunnelAddressAssignerWithOptions(context.Background(), &TunnelAddressAssignerOptions{LeaseStore: NewFileCidrLeaseStore(path)})
+
+	pair, err := first.GetTunnelPairE(29)
+	require.NoError(t, err)
+	assert.Equal(t, "169.254.0.8/29", pair.Cidr)
+
+	pair, err = second.GetTunnelPairE(29)
+	require.NoError(t, err)
+	assert.Equal(t, "169.254.0.16/29", pair.Cidr)
+}